@@ -0,0 +1,82 @@
+// Package anim contains frame-rate independent timing helpers shared by the
+// stage and UI.
+package anim
+
+import "time"
+
+// Easing maps linear progress in [0, 1] to eased progress in [0, 1].
+type Easing func(t float64) float64
+
+// Linear advances at a constant rate.
+func Linear(t float64) float64 { return t }
+
+// EaseIn starts slowly and accelerates.
+func EaseIn(t float64) float64 { return t * t }
+
+// EaseOut starts quickly and decelerates.
+func EaseOut(t float64) float64 { return 1 - (1-t)*(1-t) }
+
+// EaseInOut accelerates through the first half and decelerates through the
+// second.
+func EaseInOut(t float64) float64 {
+	if t < 0.5 {
+		return 2 * t * t
+	}
+	return 1 - 2*(1-t)*(1-t)
+}
+
+// CubicIn is a stronger version of EaseIn.
+func CubicIn(t float64) float64 { return t * t * t }
+
+// CubicOut is a stronger version of EaseOut.
+func CubicOut(t float64) float64 {
+	u := 1 - t
+	return 1 - u*u*u
+}
+
+// CubicInOut is a stronger version of EaseInOut.
+func CubicInOut(t float64) float64 {
+	if t < 0.5 {
+		return 4 * t * t * t
+	}
+	u := 1 - t
+	return 1 - 4*u*u*u
+}
+
+var easings = map[string]Easing{
+	"linear":     Linear,
+	"easeIn":     EaseIn,
+	"easeOut":    EaseOut,
+	"easeInOut":  EaseInOut,
+	"cubic":      CubicInOut,
+	"cubicIn":    CubicIn,
+	"cubicOut":   CubicOut,
+	"cubicInOut": CubicInOut,
+}
+
+// EasingByName returns the easing curve registered under name. Unknown or
+// empty names fall back to Linear.
+func EasingByName(name string) Easing {
+	if e, ok := easings[name]; ok {
+		return e
+	}
+	return Linear
+}
+
+// Progress returns how far elapsed is through d as a value in [0, 1]. A zero
+// or negative duration is always complete.
+func Progress(elapsed, d time.Duration) float64 {
+	if d <= 0 || elapsed >= d {
+		return 1
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(elapsed) / float64(d)
+}
+
+// FramesToDuration converts a legacy frame count, measured at 60 frames per
+// second, into a duration.
+func FramesToDuration(frames int) time.Duration {
+	return time.Duration(frames) * time.Second / 60
+}
@@ -0,0 +1,87 @@
+//go:build headless
+// +build headless
+
+package anim
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEasingEndpoints(t *testing.T) {
+	for name, e := range easings {
+		if got := e(0); math.Abs(got) > 1e-9 {
+			t.Errorf("%s(0) = %v, want 0", name, got)
+		}
+		if got := e(1); math.Abs(got-1) > 1e-9 {
+			t.Errorf("%s(1) = %v, want 1", name, got)
+		}
+	}
+}
+
+func TestEasingShape(t *testing.T) {
+	if EaseIn(0.5) >= 0.5 {
+		t.Errorf("EaseIn should lag behind linear at the midpoint")
+	}
+	if EaseOut(0.5) <= 0.5 {
+		t.Errorf("EaseOut should lead linear at the midpoint")
+	}
+	if got := CubicInOut(0.5); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("CubicInOut(0.5) = %v, want 0.5", got)
+	}
+}
+
+func TestEasingByNameFallback(t *testing.T) {
+	if got := EasingByName("nope")(0.25); got != 0.25 {
+		t.Errorf("unknown easing should be linear, got %v", got)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		elapsed, d time.Duration
+		want       float64
+	}{
+		{0, time.Second, 0},
+		{500 * time.Millisecond, time.Second, 0.5},
+		{2 * time.Second, time.Second, 1},
+		{0, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := Progress(tt.elapsed, tt.d); got != tt.want {
+			t.Errorf("Progress(%v, %v) = %v, want %v", tt.elapsed, tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestFramesToDuration(t *testing.T) {
+	if got := FramesToDuration(30); got != 500*time.Millisecond {
+		t.Errorf("FramesToDuration(30) = %v, want 500ms", got)
+	}
+}
+
+func TestTween(t *testing.T) {
+	tw := NewTween(100*time.Millisecond, EaseIn)
+	if tw.Done() || tw.Value() != 0 {
+		t.Fatalf("new tween should start at zero")
+	}
+	tw.Update(50 * time.Millisecond)
+	if got := tw.Value(); got != 0.25 {
+		t.Errorf("Value = %v, want 0.25", got)
+	}
+	if got := tw.Linear(); got != 0.5 {
+		t.Errorf("Linear = %v, want 0.5", got)
+	}
+	tw.Finish()
+	if !tw.Done() || tw.Value() != 1 {
+		t.Errorf("finished tween should be done at 1")
+	}
+	var zero Tween
+	if !zero.Done() {
+		t.Errorf("zero tween should be done")
+	}
+	if got := Lerp(10, 20, 0.25); got != 12.5 {
+		t.Errorf("Lerp = %v", got)
+	}
+}
@@ -0,0 +1,47 @@
+package anim
+
+import "time"
+
+// Tween tracks eased progress over a fixed duration. The zero value is a
+// finished tween.
+type Tween struct {
+	Duration time.Duration
+	Elapsed  time.Duration
+	Easing   Easing
+}
+
+// NewTween starts a tween lasting d. A nil easing is linear.
+func NewTween(d time.Duration, easing Easing) Tween {
+	if easing == nil {
+		easing = Linear
+	}
+	return Tween{Duration: d, Easing: easing}
+}
+
+// Update advances the tween by dt.
+func (t *Tween) Update(dt time.Duration) {
+	if t.Elapsed < t.Duration {
+		t.Elapsed += dt
+	}
+}
+
+// Finish jumps to the end of the tween.
+func (t *Tween) Finish() { t.Elapsed = t.Duration }
+
+// Done reports whether the tween has reached its end.
+func (t Tween) Done() bool { return t.Elapsed >= t.Duration }
+
+// Linear returns un-eased progress in [0, 1].
+func (t Tween) Linear() float64 { return Progress(t.Elapsed, t.Duration) }
+
+// Value returns eased progress in [0, 1].
+func (t Tween) Value() float64 {
+	p := t.Linear()
+	if t.Easing == nil || p >= 1 {
+		return p
+	}
+	return t.Easing(p)
+}
+
+// Lerp interpolates between a and b.
+func Lerp(a, b, t float64) float64 { return a + (b-a)*t }
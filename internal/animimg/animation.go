@@ -0,0 +1,84 @@
+// Package animimg loads animated stage images: sprite sheets described by a
+// JSON file, animated GIFs and APNGs. Every kind yields an Animation, the
+// frame timing, alongside the frame images, so that a renderer only has to
+// ask which frame is showing at a given time.
+package animimg
+
+import (
+	"image"
+	"time"
+)
+
+// Loop modes.
+const (
+	// Loop plays the frames in order forever, or Plays times.
+	Loop = "loop"
+	// Once plays the frames a single time and holds the last.
+	Once = "once"
+	// PingPong plays the frames forwards and then backwards.
+	PingPong = "pingpong"
+)
+
+// Frame is one frame of an animation. Rect is the frame's area of a sprite
+// sheet and is empty for decoded GIF and APNG frames.
+type Frame struct {
+	Rect     image.Rectangle
+	Duration time.Duration
+}
+
+// Animation is the timing of a sequence of frames. Plays limits how often
+// the sequence repeats; zero repeats forever.
+type Animation struct {
+	Frames []Frame
+	Mode   string
+	Plays  int
+}
+
+// sequence returns the frame indices of one cycle.
+func (a *Animation) sequence() []int {
+	n := len(a.Frames)
+	seq := make([]int, 0, 2*n)
+	for i := 0; i < n; i++ {
+		seq = append(seq, i)
+	}
+	if a.Mode == PingPong {
+		for i := n - 2; i > 0; i-- {
+			seq = append(seq, i)
+		}
+	}
+	return seq
+}
+
+// FrameAt returns the index of the frame showing t after the animation
+// started.
+func (a *Animation) FrameAt(t time.Duration) int {
+	if len(a.Frames) <= 1 {
+		return 0
+	}
+	seq := a.sequence()
+	var cycle time.Duration
+	for _, i := range seq {
+		cycle += a.Frames[i].Duration
+	}
+	if cycle <= 0 {
+		return 0
+	}
+	plays := a.Plays
+	if a.Mode == Once {
+		plays = 1
+	}
+	if plays > 0 && t >= cycle*time.Duration(plays) {
+		return seq[len(seq)-1]
+	}
+	if t < 0 {
+		t = 0
+	}
+	t %= cycle
+	for _, i := range seq {
+		if t < a.Frames[i].Duration {
+			return i
+		}
+		t -= a.Frames[i].Duration
+	}
+	return seq[len(seq)-1]
+}
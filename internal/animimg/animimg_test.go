@@ -0,0 +1,211 @@
+//go:build headless
+// +build headless
+
+package animimg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func ms(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+func frames(ds ...int) []Frame {
+	var fs []Frame
+	for _, d := range ds {
+		fs = append(fs, Frame{Duration: ms(d)})
+	}
+	return fs
+}
+
+func TestFrameAt(t *testing.T) {
+	tests := []struct {
+		name string
+		a    Animation
+		t    time.Duration
+		want int
+	}{
+		{"first", Animation{Frames: frames(100, 100, 100)}, 0, 0},
+		{"second", Animation{Frames: frames(100, 100, 100)}, ms(150), 1},
+		{"loops", Animation{Frames: frames(100, 100, 100)}, ms(350), 0},
+		{"once holds last", Animation{Frames: frames(100, 100, 100), Mode: Once}, ms(5000), 2},
+		{"plays", Animation{Frames: frames(100, 100), Plays: 2}, ms(350), 1},
+		{"pingpong back", Animation{Frames: frames(100, 100, 100), Mode: PingPong}, ms(350), 1},
+		{"pingpong wraps", Animation{Frames: frames(100, 100, 100), Mode: PingPong}, ms(450), 0},
+		{"single frame", Animation{Frames: frames(100)}, ms(999), 0},
+	}
+	for _, tt := range tests {
+		if got := tt.a.FrameAt(tt.t); got != tt.want {
+			t.Errorf("%s: FrameAt(%v) = %d, want %d", tt.name, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestParseSheet(t *testing.T) {
+	s, err := ParseSheet([]byte(`{"image": "walk.png", "grid": {"w": 10, "h": 20, "count": 3, "columns": 2, "ms": 50}, "loop": "pingpong"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := s.Animation()
+	want := []image.Rectangle{image.Rect(0, 0, 10, 20), image.Rect(10, 0, 20, 20), image.Rect(0, 20, 10, 40)}
+	if len(a.Frames) != 3 || a.Mode != PingPong {
+		t.Fatalf("animation = %+v", a)
+	}
+	for i, r := range want {
+		if a.Frames[i].Rect != r || a.Frames[i].Duration != ms(50) {
+			t.Errorf("frame %d = %+v, want %v", i, a.Frames[i], r)
+		}
+	}
+
+	s, err = ParseSheet([]byte(`{"image": "a.png", "frames": [{"x": 5, "y": 0, "w": 5, "h": 5, "ms": 30}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := s.Animation().Frames[0]; f.Rect != image.Rect(5, 0, 10, 5) || f.Duration != ms(30) {
+		t.Errorf("listed frame = %+v", f)
+	}
+	if _, err := ParseSheet([]byte(`{"image": "a.png"}`)); err == nil {
+		t.Errorf("a sheet without frames should fail")
+	}
+}
+
+func TestDecodeGIF(t *testing.T) {
+	pal := color.Palette{color.Transparent, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	f0 := image.NewPaletted(image.Rect(0, 0, 2, 2), pal)
+	f0.SetColorIndex(0, 0, 1)
+	f1 := image.NewPaletted(image.Rect(1, 1, 2, 2), pal)
+	f1.SetColorIndex(1, 1, 2)
+	var b bytes.Buffer
+	err := gif.EncodeAll(&b, &gif.GIF{
+		Image:     []*image.Paletted{f0, f1},
+		Delay:     []int{5, 20},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalNone},
+		LoopCount: -1,
+		Config:    image.Config{Width: 2, Height: 2, ColorModel: pal},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgs, a, err := DecodeGIF(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imgs) != 2 || a.Plays != 1 || a.Frames[0].Duration != ms(50) || a.Frames[1].Duration != ms(200) {
+		t.Fatalf("frames = %d, animation = %+v", len(imgs), a)
+	}
+	if c := imgs[1].RGBAAt(0, 0); c != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("second frame should keep the first underneath, got %v", c)
+	}
+	if c := imgs[1].RGBAAt(1, 1); c != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("second frame pixel = %v", c)
+	}
+}
+
+// buildAPNG assembles an APNG from still frames placed at the given
+// offsets, the first covering the whole image.
+func buildAPNG(t *testing.T, imgs []*image.RGBA, offsets []image.Point, delayMs uint16) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	seq := uint32(0)
+	for i, img := range imgs {
+		var b bytes.Buffer
+		if err := png.Encode(&b, img); err != nil {
+			t.Fatal(err)
+		}
+		chunks, err := readChunks(b.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			writeChunk(&out, "IHDR", chunks[0].data)
+			actl := make([]byte, 8)
+			binary.BigEndian.PutUint32(actl, uint32(len(imgs)))
+			writeChunk(&out, "acTL", actl)
+		}
+		fctl := make([]byte, 26)
+		be := binary.BigEndian
+		be.PutUint32(fctl[0:], seq)
+		seq++
+		be.PutUint32(fctl[4:], uint32(img.Bounds().Dx()))
+		be.PutUint32(fctl[8:], uint32(img.Bounds().Dy()))
+		be.PutUint32(fctl[12:], uint32(offsets[i].X))
+		be.PutUint32(fctl[16:], uint32(offsets[i].Y))
+		be.PutUint16(fctl[20:], delayMs)
+		be.PutUint16(fctl[22:], 1000)
+		fctl[25] = 1 // blend over
+		writeChunk(&out, "fcTL", fctl)
+		for _, c := range chunks {
+			if c.typ != "IDAT" {
+				continue
+			}
+			if i == 0 {
+				writeChunk(&out, "IDAT", c.data)
+				continue
+			}
+			d := make([]byte, 4, 4+len(c.data))
+			be.PutUint32(d, seq)
+			seq++
+			writeChunk(&out, "fdAT", append(d, c.data...))
+		}
+	}
+	writeChunk(&out, "IEND", nil)
+	return out.Bytes()
+}
+
+func TestDecodeAPNG(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	f0 := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	f0.SetRGBA(0, 0, red)
+	// Frames must share the colour type, so both keep a transparent pixel.
+	f1 := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	f1.SetRGBA(1, 0, blue)
+	data := buildAPNG(t, []*image.RGBA{f0, f1}, []image.Point{{0, 0}, {0, 1}}, 120)
+
+	if !IsAPNG(data) {
+		t.Fatalf("IsAPNG = false")
+	}
+	imgs, a, err := DecodeAPNG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imgs) != 2 || a.Frames[1].Duration != ms(120) || a.Plays != 0 {
+		t.Fatalf("frames = %d, animation = %+v", len(imgs), a)
+	}
+	if c := imgs[1].RGBAAt(0, 0); c != red {
+		t.Errorf("second frame should blend over the first, got %v", c)
+	}
+	if c := imgs[1].RGBAAt(1, 1); c != blue {
+		t.Errorf("second frame offset pixel = %v", c)
+	}
+
+	var still bytes.Buffer
+	png.Encode(&still, f0)
+	if IsAPNG(still.Bytes()) {
+		t.Errorf("a still PNG is not an APNG")
+	}
+}
+
+func TestDecodeAPNGRejectsBadSizes(t *testing.T) {
+	f0 := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	f1 := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	if _, _, err := DecodeAPNG(buildAPNG(t, []*image.RGBA{f0, f1}, []image.Point{{0, 0}, {1, 1}}, 100)); err == nil {
+		t.Errorf("a frame outside the canvas should be rejected")
+	}
+
+	data := buildAPNG(t, []*image.RGBA{f0}, []image.Point{{0, 0}}, 100)
+	// Rewrite the IHDR, the first chunk, to claim a huge canvas.
+	ihdr := data[len(pngSignature):]
+	binary.BigEndian.PutUint32(ihdr[8:], 1<<30)
+	binary.BigEndian.PutUint32(ihdr[12:], 1<<30)
+	if _, _, err := DecodeAPNG(data); err == nil {
+		t.Errorf("a huge canvas should be rejected")
+	}
+}
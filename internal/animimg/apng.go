@@ -0,0 +1,221 @@
+package animimg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"time"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// APNG frame disposal and blend operations.
+const (
+	apngDisposeNone       = 0
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+	apngBlendSource       = 0
+)
+
+// APNG size limits. Every frame is decoded to a full canvas, so both the
+// canvas and the frames kept in total are capped to keep a broken or
+// hostile file from exhausting memory.
+const (
+	maxAPNGSide   = 8192
+	maxAPNGPixels = 1 << 28
+)
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+func readChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("animimg: not a PNG")
+	}
+	var chunks []pngChunk
+	p := data[len(pngSignature):]
+	for len(p) >= 12 {
+		n := binary.BigEndian.Uint32(p)
+		if uint64(n)+12 > uint64(len(p)) {
+			return nil, errors.New("animimg: truncated PNG chunk")
+		}
+		chunks = append(chunks, pngChunk{typ: string(p[4:8]), data: p[8 : 8+n]})
+		p = p[12+n:]
+	}
+	return chunks, nil
+}
+
+func writeChunk(b *bytes.Buffer, typ string, data []byte) {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(data)))
+	copy(hdr[4:], typ)
+	b.Write(hdr[:])
+	b.Write(data)
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data)
+	binary.Write(b, binary.BigEndian, crc.Sum32())
+}
+
+// IsAPNG reports whether data is a PNG with animation control, that is an
+// APNG rather than a still image.
+func IsAPNG(data []byte) bool {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return false
+	}
+	for _, c := range chunks {
+		switch c.typ {
+		case "acTL":
+			return true
+		case "IDAT":
+			return false
+		}
+	}
+	return false
+}
+
+// apngFrame is a frame control chunk and the image data that follows it.
+type apngFrame struct {
+	w, h, x, y     int
+	delay          time.Duration
+	dispose, blend byte
+	data           [][]byte
+}
+
+func parseFCTL(d []byte) (*apngFrame, error) {
+	if len(d) < 26 {
+		return nil, errors.New("animimg: short fcTL chunk")
+	}
+	be := binary.BigEndian
+	num, den := be.Uint16(d[20:]), be.Uint16(d[22:])
+	if den == 0 {
+		den = 100
+	}
+	return &apngFrame{
+		w:       int(be.Uint32(d[4:])),
+		h:       int(be.Uint32(d[8:])),
+		x:       int(be.Uint32(d[12:])),
+		y:       int(be.Uint32(d[16:])),
+		delay:   time.Duration(num) * time.Second / time.Duration(den),
+		dispose: d[24],
+		blend:   d[25],
+	}, nil
+}
+
+// DecodeAPNG decodes every frame of an APNG into full-size images, applying
+// each frame's blend and disposal. A default image that is not part of the
+// animation is skipped.
+func DecodeAPNG(data []byte) ([]*image.RGBA, Animation, error) {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return nil, Animation{}, err
+	}
+	var (
+		ihdr   []byte
+		shared []pngChunk // PLTE, tRNS and other chunks every frame needs
+		frames []*apngFrame
+		cur    *apngFrame
+		a      = Animation{Mode: Loop}
+		seenID bool
+	)
+	for _, c := range chunks {
+		switch c.typ {
+		case "IHDR":
+			ihdr = c.data
+		case "acTL":
+			if len(c.data) >= 8 {
+				a.Plays = int(binary.BigEndian.Uint32(c.data[4:]))
+			}
+		case "fcTL":
+			if cur, err = parseFCTL(c.data); err != nil {
+				return nil, Animation{}, err
+			}
+			frames = append(frames, cur)
+		case "IDAT":
+			seenID = true
+			if cur != nil {
+				cur.data = append(cur.data, c.data)
+			}
+		case "fdAT":
+			if cur != nil && len(c.data) >= 4 {
+				cur.data = append(cur.data, c.data[4:])
+			}
+		case "IEND":
+		default:
+			if !seenID && cur == nil {
+				shared = append(shared, c)
+			}
+		}
+	}
+	if ihdr == nil || len(ihdr) < 8 || len(frames) == 0 {
+		return nil, Animation{}, errors.New("animimg: no APNG frames")
+	}
+
+	be := binary.BigEndian
+	w, h := be.Uint32(ihdr[0:]), be.Uint32(ihdr[4:])
+	if w == 0 || h == 0 || w > maxAPNGSide || h > maxAPNGSide {
+		return nil, Animation{}, fmt.Errorf("animimg: APNG size %dx%d out of range", w, h)
+	}
+	if uint64(w)*uint64(h)*uint64(len(frames)) > maxAPNGPixels {
+		return nil, Animation{}, fmt.Errorf("animimg: %d frames of %dx%d is too large", len(frames), w, h)
+	}
+	bounds := image.Rect(0, 0, int(w), int(h))
+	for _, f := range frames {
+		if f.w <= 0 || f.h <= 0 || !image.Rect(f.x, f.y, f.x+f.w, f.y+f.h).In(bounds) {
+			return nil, Animation{}, fmt.Errorf("animimg: APNG frame %dx%d at (%d, %d) outside the %dx%d canvas", f.w, f.h, f.x, f.y, w, h)
+		}
+	}
+	canvas := image.NewRGBA(bounds)
+	var out []*image.RGBA
+	for _, f := range frames {
+		img, err := decodeFrame(ihdr, shared, f)
+		if err != nil {
+			return nil, Animation{}, err
+		}
+		r := image.Rect(f.x, f.y, f.x+f.w, f.y+f.h)
+		var saved *image.RGBA
+		if f.dispose == apngDisposePrevious {
+			saved = cloneRGBA(canvas)
+		}
+		op := draw.Over
+		if f.blend == apngBlendSource {
+			op = draw.Src
+		}
+		draw.Draw(canvas, r, img, img.Bounds().Min, op)
+		out = append(out, cloneRGBA(canvas))
+		a.Frames = append(a.Frames, Frame{Duration: f.delay})
+		switch f.dispose {
+		case apngDisposeBackground:
+			draw.Draw(canvas, r, image.Transparent, image.Point{}, draw.Src)
+		case apngDisposePrevious:
+			canvas = saved
+		}
+	}
+	return out, a, nil
+}
+
+// decodeFrame rebuilds a still PNG holding one frame and decodes it.
+func decodeFrame(ihdr []byte, shared []pngChunk, f *apngFrame) (image.Image, error) {
+	var b bytes.Buffer
+	b.Write(pngSignature)
+	hdr := append([]byte(nil), ihdr...)
+	binary.BigEndian.PutUint32(hdr[0:], uint32(f.w))
+	binary.BigEndian.PutUint32(hdr[4:], uint32(f.h))
+	writeChunk(&b, "IHDR", hdr)
+	for _, c := range shared {
+		writeChunk(&b, c.typ, c.data)
+	}
+	for _, d := range f.data {
+		writeChunk(&b, "IDAT", d)
+	}
+	writeChunk(&b, "IEND", nil)
+	return png.Decode(&b)
+}
@@ -0,0 +1,58 @@
+package animimg
+
+import (
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+)
+
+// DecodeGIF decodes every frame of a GIF into full-size images, applying
+// each frame's disposal.
+func DecodeGIF(r io.Reader) ([]*image.RGBA, Animation, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, Animation{}, err
+	}
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(bounds)
+	a := Animation{Mode: Loop}
+	switch {
+	case g.LoopCount < 0:
+		a.Plays = 1
+	case g.LoopCount > 0:
+		a.Plays = g.LoopCount + 1
+	}
+	var frames []*image.RGBA
+	for i, img := range g.Image {
+		var saved *image.RGBA
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			saved = cloneRGBA(canvas)
+		}
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+		frames = append(frames, cloneRGBA(canvas))
+		delay := 10
+		if i < len(g.Delay) && g.Delay[i] > 0 {
+			delay = g.Delay[i]
+		}
+		a.Frames = append(a.Frames, Frame{Duration: time.Duration(delay) * 10 * time.Millisecond})
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = saved
+		}
+	}
+	return frames, a, nil
+}
+
+func cloneRGBA(src *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(src.Rect)
+	copy(dst.Pix, src.Pix)
+	return dst
+}
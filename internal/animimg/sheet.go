@@ -0,0 +1,78 @@
+package animimg
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"time"
+)
+
+// Sheet is a sprite sheet descriptor. Image names the sheet, relative to the
+// descriptor. Frames may be listed one by one, or described by Grid as
+// equal cells read left to right and top to bottom.
+type Sheet struct {
+	Image  string       `json:"image"`
+	Frames []SheetFrame `json:"frames,omitempty"`
+	Grid   *Grid        `json:"grid,omitempty"`
+	Loop   string       `json:"loop,omitempty"`
+	Plays  int          `json:"plays,omitempty"`
+}
+
+// SheetFrame is one frame of a sheet and how long it shows.
+type SheetFrame struct {
+	X  int `json:"x"`
+	Y  int `json:"y"`
+	W  int `json:"w"`
+	H  int `json:"h"`
+	Ms int `json:"ms"`
+}
+
+// Grid describes Count frames of W×H pixels, each shown for Ms, laid out in
+// Columns columns. Columns defaults to Count.
+type Grid struct {
+	W       int `json:"w"`
+	H       int `json:"h"`
+	Count   int `json:"count"`
+	Columns int `json:"columns,omitempty"`
+	Ms      int `json:"ms"`
+}
+
+// ParseSheet reads a sheet descriptor.
+func ParseSheet(data []byte) (*Sheet, error) {
+	var s Sheet
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if s.Image == "" {
+		return nil, errors.New("animimg: sheet has no image")
+	}
+	if len(s.Frames) == 0 && (s.Grid == nil || s.Grid.Count <= 0) {
+		return nil, errors.New("animimg: sheet has no frames")
+	}
+	return &s, nil
+}
+
+// Animation returns the frames of the sheet.
+func (s *Sheet) Animation() Animation {
+	a := Animation{Mode: s.Loop, Plays: s.Plays}
+	for _, f := range s.Frames {
+		a.Frames = append(a.Frames, Frame{
+			Rect:     image.Rect(f.X, f.Y, f.X+f.W, f.Y+f.H),
+			Duration: time.Duration(f.Ms) * time.Millisecond,
+		})
+	}
+	if g := s.Grid; g != nil && len(s.Frames) == 0 {
+		cols := g.Columns
+		if cols <= 0 {
+			cols = g.Count
+		}
+		for i := 0; i < g.Count; i++ {
+			x, y := (i%cols)*g.W, (i/cols)*g.H
+			a.Frames = append(a.Frames, Frame{
+				Rect:     image.Rect(x, y, x+g.W, y+g.H),
+				Duration: time.Duration(g.Ms) * time.Millisecond,
+			})
+		}
+	}
+	return a
+}
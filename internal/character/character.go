@@ -0,0 +1,202 @@
+// Package character loads the cast of a project: display names, colours,
+// sprite and portrait files per expression and voice settings. Scripts refer
+// to characters by ID, so renaming or re-exporting art touches one file.
+package character
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Localized is a string with one value per language code. In JSON it may be
+// written either as a plain string or as an object such as
+// {"ja": "クロ", "en": "Kuro"}.
+type Localized map[string]string
+
+// UnmarshalJSON accepts a plain string or a language map.
+func (l *Localized) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = Localized{"": s}
+		return nil
+	}
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*l = m
+	return nil
+}
+
+// Get returns the value for lang, falling back to the unlabelled value and
+// then to the alphabetically first language.
+func (l Localized) Get(lang string) string {
+	if v, ok := l[lang]; ok {
+		return v
+	}
+	if v, ok := l[""]; ok {
+		return v
+	}
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		return l[keys[0]]
+	}
+	return ""
+}
+
+// Color is a colour written in JSON as "#rrggbb" or "#rrggbbaa".
+type Color struct {
+	color.RGBA
+	Set bool
+}
+
+// UnmarshalJSON parses a hex colour string.
+func (c *Color) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	rgba, err := ParseColor(s)
+	if err != nil {
+		return err
+	}
+	*c = Color{RGBA: rgba, Set: true}
+	return nil
+}
+
+// ParseColor parses "#rrggbb" or "#rrggbbaa".
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	var r, g, b uint8
+	a := uint8(255)
+	switch len(s) {
+	case 6:
+		if _, err := fmt.Sscanf(s, "%02x%02x%02x", &r, &g, &b); err != nil {
+			return color.RGBA{}, fmt.Errorf("character: bad colour %q", s)
+		}
+	case 8:
+		if _, err := fmt.Sscanf(s, "%02x%02x%02x%02x", &r, &g, &b, &a); err != nil {
+			return color.RGBA{}, fmt.Errorf("character: bad colour %q", s)
+		}
+	default:
+		return color.RGBA{}, fmt.Errorf("character: bad colour %q", s)
+	}
+	return color.RGBA{r, g, b, a}, nil
+}
+
+// Voice holds default voice playback settings for a character.
+type Voice struct {
+	// Dir is prepended to voice file names given in the script.
+	Dir string `json:"dir"`
+	// Volume scales voice playback; zero means full volume.
+	Volume float64 `json:"volume"`
+}
+
+// Character describes one member of the cast.
+type Character struct {
+	Name      Localized         `json:"name"`
+	NameColor Color             `json:"nameColor"`
+	TextColor Color             `json:"textColor"`
+	Sprites   map[string]string `json:"sprites"`
+	Portraits map[string]string `json:"portraits"`
+	Voice     Voice             `json:"voice"`
+	// Layered, when set, composes sprites from parts and takes the place
+	// of Sprites.
+	Layered *Layered `json:"layered,omitempty"`
+}
+
+// Registry maps character IDs to their definitions.
+type Registry struct {
+	Lang  string
+	chars map[string]*Character
+}
+
+// NewRegistry returns a registry holding chars.
+func NewRegistry(lang string, chars map[string]*Character) *Registry {
+	if chars == nil {
+		chars = map[string]*Character{}
+	}
+	return &Registry{Lang: lang, chars: chars}
+}
+
+// Load reads a characters file. A missing file yields an empty registry, in
+// which case speakers and sprite files are used exactly as written.
+func Load(path, lang string) (*Registry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewRegistry(lang, nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var chars map[string]*Character
+	if err := json.NewDecoder(f).Decode(&chars); err != nil {
+		return nil, err
+	}
+	return NewRegistry(lang, chars), nil
+}
+
+// Get returns the character registered under id, or nil.
+func (r *Registry) Get(id string) *Character {
+	if r == nil {
+		return nil
+	}
+	return r.chars[id]
+}
+
+// DisplayName returns the localized name for speaker. Speakers that are not
+// registered IDs are returned unchanged.
+func (r *Registry) DisplayName(speaker string) string {
+	if c := r.Get(speaker); c != nil {
+		if n := c.Name.Get(r.Lang); n != "" {
+			return n
+		}
+	}
+	return speaker
+}
+
+// SplitRef splits a reference of the form "id:expression".
+func SplitRef(ref string) (id, expr string, ok bool) {
+	i := strings.IndexByte(ref, ':')
+	if i < 0 {
+		return "", "", false
+	}
+	return ref[:i], ref[i+1:], true
+}
+
+// SpriteFile resolves the image for character id with the given expression.
+// The character's sprite table is consulted first; otherwise the file is
+// named "<id>_<expression>.png".
+func (r *Registry) SpriteFile(id, expr string) string {
+	if c := r.Get(id); c != nil {
+		if f, ok := c.Sprites[expr]; ok {
+			return f
+		}
+	}
+	return id + "_" + expr + ".png"
+}
+
+// PortraitFile returns the side portrait for id and expression, falling back
+// to the character's "default" portrait. It is empty when the character has
+// no portraits.
+func (r *Registry) PortraitFile(id, expr string) string {
+	c := r.Get(id)
+	if c == nil {
+		return ""
+	}
+	if f, ok := c.Portraits[expr]; ok {
+		return f
+	}
+	return c.Portraits["default"]
+}
@@ -0,0 +1,98 @@
+//go:build headless
+// +build headless
+
+package character
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const castJSON = `{
+	"kuro": {
+		"name": {"ja": "クロ", "en": "Kuro"},
+		"nameColor": "#ff8800",
+		"sprites": {"smile": "kuro_joy.png"},
+		"portraits": {"default": "kuro_face.png"},
+		"voice": {"dir": "voice/kuro", "volume": 0.8}
+	},
+	"siro": {"name": "シロ"}
+}`
+
+func loadCast(t *testing.T, lang string) *Registry {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "characters.json")
+	if err := os.WriteFile(path, []byte(castJSON), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Load(path, lang)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	return r
+}
+
+func TestDisplayName(t *testing.T) {
+	ja := loadCast(t, "ja")
+	en := loadCast(t, "en")
+	if got := ja.DisplayName("kuro"); got != "クロ" {
+		t.Errorf("ja name = %q", got)
+	}
+	if got := en.DisplayName("kuro"); got != "Kuro" {
+		t.Errorf("en name = %q", got)
+	}
+	if got := en.DisplayName("siro"); got != "シロ" {
+		t.Errorf("plain name = %q", got)
+	}
+	if got := en.DisplayName("Narrator"); got != "Narrator" {
+		t.Errorf("unregistered speaker = %q", got)
+	}
+}
+
+func TestSpriteFile(t *testing.T) {
+	r := loadCast(t, "ja")
+	if got := r.SpriteFile("kuro", "smile"); got != "kuro_joy.png" {
+		t.Errorf("mapped sprite = %q", got)
+	}
+	if got := r.SpriteFile("kuro", "joy"); got != "kuro_joy.png" {
+		t.Errorf("conventional sprite = %q", got)
+	}
+	if got := r.PortraitFile("kuro", "joy"); got != "kuro_face.png" {
+		t.Errorf("portrait = %q", got)
+	}
+	if got := r.PortraitFile("siro", "joy"); got != "" {
+		t.Errorf("missing portrait = %q", got)
+	}
+}
+
+func TestColorsAndVoice(t *testing.T) {
+	c := loadCast(t, "ja").Get("kuro")
+	if !c.NameColor.Set || c.NameColor.RGBA != (color.RGBA{0xff, 0x88, 0x00, 0xff}) {
+		t.Errorf("name colour = %+v", c.NameColor)
+	}
+	if c.TextColor.Set {
+		t.Errorf("text colour should be unset")
+	}
+	if c.Voice.Dir != "voice/kuro" || c.Voice.Volume != 0.8 {
+		t.Errorf("voice = %+v", c.Voice)
+	}
+}
+
+func TestSplitRef(t *testing.T) {
+	id, expr, ok := SplitRef("kuro:joy")
+	if !ok || id != "kuro" || expr != "joy" {
+		t.Errorf("SplitRef = %q %q %v", id, expr, ok)
+	}
+	if _, _, ok := SplitRef("kuro_joy.png"); ok {
+		t.Errorf("plain file should not split")
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	r, err := Load(filepath.Join(t.TempDir(), "none.json"), "ja")
+	if err != nil || r.Get("kuro") != nil {
+		t.Fatalf("expected empty registry, got %v %v", r, err)
+	}
+}
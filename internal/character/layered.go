@@ -0,0 +1,84 @@
+package character
+
+import "encoding/json"
+
+// ExprSlot is the slot of a layered character that a sprite's expression
+// selects.
+const ExprSlot = "face"
+
+// Part is one image of a layered sprite, drawn Offset pixels from the
+// top-left corner of the body. In JSON it may be written as just the file
+// name when there is no offset.
+type Part struct {
+	File   string     `json:"file"`
+	Offset [2]float64 `json:"offset,omitempty"`
+}
+
+// UnmarshalJSON accepts a file name or an object.
+func (p *Part) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*p = Part{File: s}
+		return nil
+	}
+	type plain Part
+	return json.Unmarshal(data, (*plain)(p))
+}
+
+// Layered describes a sprite built from a body and switchable parts instead
+// of one image per expression. Slots lists the part slots from bottom to
+// top, for example "outfit", "face", "eyebrow", "mouth" and "accessory".
+// Parts holds the choices for each slot and Defaults the choice used when a
+// sprite names none; a slot with neither is left empty.
+//
+// Blink and Talk are optional idle animations that swap parts of one slot:
+// eye frames for blinking and mouth frames for speaking.
+type Layered struct {
+	Body     Part                       `json:"body"`
+	Slots    []string                   `json:"slots"`
+	Parts    map[string]map[string]Part `json:"parts"`
+	Defaults map[string]string          `json:"defaults,omitempty"`
+	Blink    *Blink                     `json:"blink,omitempty"`
+	Talk     *FrameAnim                 `json:"talk,omitempty"`
+}
+
+// FrameAnim plays the parts named by Frames in Slot, each for FrameMs.
+type FrameAnim struct {
+	Slot    string   `json:"slot"`
+	Frames  []string `json:"frames"`
+	FrameMs int      `json:"frameMs,omitempty"`
+}
+
+// Blink plays its frames once at random intervals, no closer together than
+// IntervalMs[0] and on average about IntervalMs[1] apart.
+type Blink struct {
+	FrameAnim
+	IntervalMs [2]int `json:"intervalMs,omitempty"`
+}
+
+// Compose returns the parts to draw for character id, body first. The
+// expression chooses the ExprSlot part unless choices names one, and
+// choices maps other slots to their parts. ok is false when the character
+// is not layered. Unknown choices fall back to the slot's default.
+func (r *Registry) Compose(id, expr string, choices map[string]string) (parts []Part, ok bool) {
+	c := r.Get(id)
+	if c == nil || c.Layered == nil {
+		return nil, false
+	}
+	l := c.Layered
+	parts = append(parts, l.Body)
+	for _, slot := range l.Slots {
+		name, set := choices[slot]
+		if !set && slot == ExprSlot {
+			name, set = expr, expr != ""
+		}
+		p, found := l.Parts[slot][name]
+		if !set || !found {
+			p, found = l.Parts[slot][l.Defaults[slot]]
+		}
+		if found {
+			parts = append(parts, p)
+		}
+	}
+	return parts, true
+}
@@ -0,0 +1,58 @@
+//go:build headless
+// +build headless
+
+package character
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const layeredJSON = `{
+	"kuro": {
+		"layered": {
+			"body": "kuro/body.png",
+			"slots": ["outfit", "face", "accessory"],
+			"parts": {
+				"outfit": {"school": "kuro/school.png", "winter": {"file": "kuro/winter.png", "offset": [0, 40]}},
+				"face": {"neutral": {"file": "kuro/neutral.png", "offset": [60, 20]}, "joy": {"file": "kuro/joy.png", "offset": [60, 20]}},
+				"accessory": {"ribbon": "kuro/ribbon.png"}
+			},
+			"defaults": {"outfit": "school", "face": "neutral"}
+		}
+	},
+	"siro": {"sprites": {"joy": "siro_joy.png"}}
+}`
+
+func TestCompose(t *testing.T) {
+	var chars map[string]*Character
+	if err := json.Unmarshal([]byte(layeredJSON), &chars); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry("ja", chars)
+
+	parts, ok := r.Compose("kuro", "joy", map[string]string{"outfit": "winter"})
+	want := []Part{
+		{File: "kuro/body.png"},
+		{File: "kuro/winter.png", Offset: [2]float64{0, 40}},
+		{File: "kuro/joy.png", Offset: [2]float64{60, 20}},
+	}
+	if !ok || !reflect.DeepEqual(parts, want) {
+		t.Fatalf("Compose = %+v, %v; want %+v", parts, ok, want)
+	}
+
+	parts, _ = r.Compose("kuro", "", map[string]string{"face": "joy", "accessory": "ribbon"})
+	if len(parts) != 4 || parts[1].File != "kuro/school.png" || parts[2].File != "kuro/joy.png" || parts[3].File != "kuro/ribbon.png" {
+		t.Fatalf("defaults and explicit face: %+v", parts)
+	}
+
+	parts, _ = r.Compose("kuro", "missing", nil)
+	if parts[2].File != "kuro/neutral.png" {
+		t.Fatalf("unknown expression should use the default face: %+v", parts)
+	}
+
+	if _, ok := r.Compose("siro", "joy", nil); ok {
+		t.Fatalf("siro is not layered")
+	}
+}
@@ -0,0 +1,91 @@
+//go:build !headless
+// +build !headless
+
+package game
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+	"novegido/internal/animimg"
+)
+
+// loadImage reads a stage image. A .json file is a sprite sheet descriptor,
+// and GIF and APNG files are decoded frame by frame; anything else is a
+// still image.
+func loadImage(path string) (stageImage, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return loadSheet(path)
+	case ".gif":
+		f, err := os.Open(path)
+		if err != nil {
+			return stageImage{}, err
+		}
+		defer f.Close()
+		imgs, a, err := animimg.DecodeGIF(f)
+		if err != nil {
+			return stageImage{}, err
+		}
+		return framesImage(imgs, a), nil
+	case ".png":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return stageImage{}, err
+		}
+		if animimg.IsAPNG(data) {
+			imgs, a, err := animimg.DecodeAPNG(data)
+			if err != nil {
+				return stageImage{}, err
+			}
+			return framesImage(imgs, a), nil
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return stageImage{}, err
+		}
+		return stageImage{Image: ebiten.NewImageFromImage(img)}, nil
+	}
+	img, _, err := ebitenutil.NewImageFromFile(path)
+	if err != nil {
+		return stageImage{}, err
+	}
+	return stageImage{Image: img}, nil
+}
+
+// loadSheet reads a sprite sheet descriptor and the sheet it names, which is
+// relative to the descriptor.
+func loadSheet(path string) (stageImage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return stageImage{}, err
+	}
+	sheet, err := animimg.ParseSheet(data)
+	if err != nil {
+		return stageImage{}, err
+	}
+	img, _, err := ebitenutil.NewImageFromFile(filepath.Join(filepath.Dir(path), sheet.Image))
+	if err != nil {
+		return stageImage{}, err
+	}
+	a := sheet.Animation()
+	frames := make([]*ebiten.Image, len(a.Frames))
+	for i, f := range a.Frames {
+		frames[i] = img.SubImage(f.Rect).(*ebiten.Image)
+	}
+	return stageImage{Image: frames[0], frames: frames, anim: a}, nil
+}
+
+func framesImage(imgs []*image.RGBA, a animimg.Animation) stageImage {
+	frames := make([]*ebiten.Image, len(imgs))
+	for i, img := range imgs {
+		frames[i] = ebiten.NewImageFromImage(img)
+	}
+	return stageImage{Image: frames[0], frames: frames, anim: a}
+}
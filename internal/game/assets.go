@@ -0,0 +1,37 @@
+package game
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// assetVariant is a file to try for an image and the pixel density it was
+// drawn at.
+type assetVariant struct {
+	File    string
+	Density float64
+}
+
+// renderDensity returns the asset density wanted at an effective render
+// scale: 2 when the stage is enlarged at all, otherwise 1.
+func renderDensity(scale float64) float64 {
+	if scale > 1 {
+		return 2
+	}
+	return 1
+}
+
+// assetVariants returns the files to try for file, best first, when images
+// of the given density are wanted. A name without a suffix is taken to be
+// 1x; "room.jpg" has the variants "room@2x.jpg" and "room@1x.jpg".
+func assetVariants(file string, density float64) []assetVariant {
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(file, ext)
+	plain := assetVariant{file, 1}
+	lo := assetVariant{base + "@1x" + ext, 1}
+	hi := assetVariant{base + "@2x" + ext, 2}
+	if density > 1 {
+		return []assetVariant{hi, plain, lo}
+	}
+	return []assetVariant{plain, lo, hi}
+}
@@ -0,0 +1,22 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAssetVariants(t *testing.T) {
+	got := assetVariants("room.jpg", renderDensity(1.5))
+	want := []assetVariant{{"room@2x.jpg", 2}, {"room.jpg", 1}, {"room@1x.jpg", 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hi-dpi variants = %v, want %v", got, want)
+	}
+	got = assetVariants("a/b.png", renderDensity(1))
+	want = []assetVariant{{"a/b.png", 1}, {"a/b@1x.png", 1}, {"a/b@2x.png", 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("1x variants = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,288 @@
+//go:build !headless
+// +build !headless
+
+package game
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2/audio"
+	"github.com/hajimehoshi/ebiten/v2/audio/mp3"
+
+	"novegido/internal/script"
+)
+
+type mp3Source struct {
+	*mp3.Stream
+	f *os.File
+}
+
+func (m *mp3Source) Close() error { return m.f.Close() }
+
+// sound is one playing file. Its volume is gain times the volume of its
+// channel times env, which fades it in and out. It starts playing once delay
+// has passed and is closed when ending and env reaches silence.
+type sound struct {
+	file    string
+	channel string
+	gain    float64
+	env     ramp
+	delay   time.Duration
+	started bool
+	ending  bool
+	player  *audio.Player
+	src     io.Closer
+}
+
+func (s *sound) close() {
+	s.player.Close()
+	s.src.Close()
+}
+
+// Mixer plays the audio channels. The looping BGM and ambient tracks follow
+// its MixerState, continuing when a page asks for the track that is already
+// playing; sound effects overlap until they finish and a new voice line cuts
+// off the previous one. Fades are advanced by Update.
+type Mixer struct {
+	ctx     *audio.Context
+	state   MixerState
+	bgm     *sound
+	ambient *sound
+	se      []*sound
+	voice   *sound
+	// fading holds sounds fading out after being stopped or replaced.
+	fading []*sound
+}
+
+// NewMixer returns a silent mixer playing through ctx.
+func NewMixer(ctx *audio.Context) *Mixer {
+	return &Mixer{ctx: ctx}
+}
+
+// State returns the persistent state of the mixer.
+func (m *Mixer) State() MixerState { return m.state }
+
+// Play performs the audio changes of a newly entered page.
+func (m *Mixer) Play(a *script.AudioInfo) {
+	if a == nil {
+		return
+	}
+	for _, st := range a.Stop {
+		m.stop(st.Channel, st.Fade())
+	}
+	m.state = applyAudio(m.state, a)
+	m.bgm = m.change(m.bgm, script.ChannelBGM, m.state.BGM, a.BGM)
+	m.ambient = m.change(m.ambient, script.ChannelAmbient, m.state.Ambient, a.Ambient)
+	for _, t := range soundEffects(a) {
+		s, err := m.open(t.File, script.ChannelSE, false)
+		if err != nil {
+			log.Printf("audio load error: %v", err)
+			continue
+		}
+		s.gain = MixerTrack{Volume: t.Volume}.Gain()
+		m.se = append(m.se, s)
+	}
+	m.refresh()
+}
+
+// Restore returns the mixer to state at once, as when rolling back or
+// loading. Sound effects and fades are cut off.
+func (m *Mixer) Restore(state MixerState) {
+	m.stopSE()
+	for _, s := range m.fading {
+		s.close()
+	}
+	m.fading = nil
+	m.state = state
+	m.bgm = m.change(m.bgm, script.ChannelBGM, state.BGM, nil)
+	m.ambient = m.change(m.ambient, script.ChannelAmbient, state.Ambient, nil)
+	m.refresh()
+}
+
+// stop silences channel, fading it out over fade.
+func (m *Mixer) stop(channel string, fade time.Duration) {
+	switch channel {
+	case script.ChannelBGM:
+		m.end(m.bgm, fade)
+		m.bgm = nil
+	case script.ChannelAmbient:
+		m.end(m.ambient, fade)
+		m.ambient = nil
+	case script.ChannelVoice:
+		m.end(m.voice, fade)
+		m.voice = nil
+	case script.ChannelSE:
+		for _, s := range m.se {
+			m.end(s, fade)
+		}
+		m.se = nil
+	}
+}
+
+// end stops s, at once or by fading it out over fade.
+func (m *Mixer) end(s *sound, fade time.Duration) {
+	if s == nil {
+		return
+	}
+	if fade <= 0 || !s.started {
+		s.close()
+		return
+	}
+	s.env = newRamp(s.env.level(), 0, fade)
+	s.ending = true
+	m.fading = append(m.fading, s)
+}
+
+// change returns the sound for the looping track t of channel, reusing cur
+// when it already plays that file. A replaced track gives way as info's
+// fades ask; a new sound is not started yet.
+func (m *Mixer) change(cur *sound, channel string, t MixerTrack, info *script.TrackInfo) *sound {
+	if cur != nil && cur.file == t.File {
+		cur.gain = t.Gain()
+		return cur
+	}
+	out, delay, in := trackFades(info)
+	if cur == nil {
+		delay = 0
+	}
+	m.end(cur, out)
+	if t.File == "" {
+		return nil
+	}
+	s, err := m.open(t.File, channel, true)
+	if err != nil {
+		log.Printf("audio load error: %v", err)
+		return nil
+	}
+	s.gain = t.Gain()
+	s.delay = delay
+	if in > 0 {
+		s.env = newRamp(0, 1, in)
+	}
+	return s
+}
+
+// sounds returns every sound the mixer holds.
+func (m *Mixer) sounds() []*sound {
+	out := append([]*sound{m.bgm, m.ambient, m.voice}, m.se...)
+	return append(out, m.fading...)
+}
+
+// refresh sets the volume of every sound and starts those that are due.
+func (m *Mixer) refresh() {
+	for _, s := range m.sounds() {
+		if s == nil {
+			continue
+		}
+		s.player.SetVolume(s.gain * m.state.Volume(s.channel) * s.env.level())
+		if !s.started && s.delay <= 0 && !s.ending {
+			s.player.Play()
+			s.started = true
+		}
+	}
+}
+
+// PlayVoice plays a voice line at gain, cutting off the previous one.
+func (m *Mixer) PlayVoice(file string, gain float64) {
+	m.StopVoice()
+	s, err := m.open(file, script.ChannelVoice, false)
+	if err != nil {
+		log.Printf("voice load error: %v", err)
+		return
+	}
+	s.gain = gain
+	m.voice = s
+	m.refresh()
+}
+
+// StopVoice cuts off the voice line.
+func (m *Mixer) StopVoice() {
+	m.end(m.voice, 0)
+	m.voice = nil
+}
+
+// VoicePlaying reports whether a voice line is playing.
+func (m *Mixer) VoicePlaying() bool {
+	return m.voice != nil && m.voice.player.IsPlaying()
+}
+
+func (m *Mixer) stopSE() {
+	for _, s := range m.se {
+		s.close()
+	}
+	m.se = nil
+}
+
+// Update advances fades and delayed starts by dt and releases sounds that
+// have finished.
+func (m *Mixer) Update(dt time.Duration) {
+	for _, s := range m.sounds() {
+		if s == nil {
+			continue
+		}
+		if s.delay > 0 {
+			s.delay -= dt
+			continue
+		}
+		s.env.update(dt)
+	}
+	se := m.se[:0]
+	for _, s := range m.se {
+		if s.player.IsPlaying() {
+			se = append(se, s)
+		} else {
+			s.close()
+		}
+	}
+	m.se = se
+	fading := m.fading[:0]
+	for _, s := range m.fading {
+		if s.env.done() || !s.player.IsPlaying() {
+			s.close()
+		} else {
+			fading = append(fading, s)
+		}
+	}
+	m.fading = fading
+	m.refresh()
+}
+
+// Playing lists what is playing as channel:file.
+func (m *Mixer) Playing() []string {
+	var out []string
+	for _, s := range m.sounds() {
+		if s != nil && s.player.IsPlaying() {
+			out = append(out, s.channel+":"+s.file)
+		}
+	}
+	return out
+}
+
+// open decodes an MP3 file under assets into a sound that is not yet
+// playing.
+func (m *Mixer) open(file, channel string, loop bool) (*sound, error) {
+	f, err := os.Open(filepath.Join("assets", file))
+	if err != nil {
+		return nil, err
+	}
+	stream, err := mp3.DecodeWithoutResampling(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	src := &mp3Source{Stream: stream, f: f}
+	var reader io.ReadSeeker = src
+	if loop {
+		reader = audio.NewInfiniteLoop(reader, stream.Length())
+	}
+	p, err := m.ctx.NewPlayer(reader)
+	if err != nil {
+		_ = src.Close()
+		return nil, err
+	}
+	return &sound{file: file, channel: channel, gain: 1, env: steady(1), player: p, src: src}, nil
+}
@@ -0,0 +1,102 @@
+package game
+
+import (
+	"math"
+
+	"novegido/internal/anim"
+	"novegido/internal/script"
+)
+
+// Camera is the view of the stage, saved with the stage state. X and Y are
+// the centre of the view as fractions of the background and Zoom its
+// magnification, 1 showing the background at its own size; Focus, when set,
+// names a sprite to centre on instead. The zero Camera shows the whole
+// stage.
+type Camera struct {
+	X     float64 `json:"x,omitempty"`
+	Y     float64 `json:"y,omitempty"`
+	Zoom  float64 `json:"zoom,omitempty"`
+	Focus string  `json:"focus,omitempty"`
+}
+
+// applyCamera returns c changed by info.
+func applyCamera(c Camera, info *script.CameraInfo) Camera {
+	if info == nil {
+		return c
+	}
+	if info.Reset {
+		return Camera{}
+	}
+	if c.Zoom <= 0 {
+		c = Camera{X: 0.5, Y: 0.5, Zoom: 1}
+	}
+	if info.Focus != "" {
+		c.Focus = info.Focus
+	}
+	if info.X != nil {
+		c.X, c.Focus = *info.X, ""
+	}
+	if info.Y != nil {
+		c.Y, c.Focus = *info.Y, ""
+	}
+	if info.Zoom > 0 {
+		c.Zoom = info.Zoom
+	}
+	return c
+}
+
+// fitCamera lays a background out for the camera: at its own size, centred
+// on the screen, and scaled up only when it would not cover the screen.
+const fitCamera = "camera"
+
+// stageRect is a rectangle in stage coordinates.
+type stageRect struct {
+	X, Y, W, H float64
+}
+
+// cameraWorld returns the area the camera moves over on a screenW×screenH
+// stage: a background of imgW×imgH laid out with fitCamera, which the
+// screen lies in the middle of.
+func cameraWorld(screenW, screenH, imgW, imgH float64) stageRect {
+	pl := fitBackground(fitCamera, screenW, screenH, imgW, imgH)
+	return stageRect{pl.X, pl.Y, imgW * pl.SX, imgH * pl.SY}
+}
+
+// cameraView is a camera resolved to a centre in stage coordinates and a
+// zoom.
+type cameraView struct {
+	X, Y, Zoom float64
+}
+
+// resolveCamera turns c into a view of world on a screenW×screenH stage.
+// focus reports the centre of a sprite in stage coordinates, or false when
+// it is not shown, in which case the camera's own centre is used. The view
+// is clamped so that it never leaves the world, which also bounds how far
+// it can zoom out; the zero Camera zooms out as far as that allows.
+func resolveCamera(c Camera, world stageRect, screenW, screenH float64, focus func(id string) (x, y float64, ok bool)) cameraView {
+	minZoom := math.Max(screenW/world.W, screenH/world.H)
+	v := cameraView{world.X + world.W/2, world.Y + world.H/2, minZoom}
+	if c.Zoom > 0 {
+		v = cameraView{world.X + c.X*world.W, world.Y + c.Y*world.H, math.Max(minZoom, c.Zoom)}
+	}
+	if c.Focus != "" && focus != nil {
+		if x, y, ok := focus(c.Focus); ok {
+			v.X, v.Y = x, y
+		}
+	}
+	hw, hh := screenW/2/v.Zoom, screenH/2/v.Zoom
+	v.X = math.Max(world.X+hw, math.Min(world.X+world.W-hw, v.X))
+	v.Y = math.Max(world.Y+hh, math.Min(world.Y+world.H-hh, v.Y))
+	return v
+}
+
+// lerpView interpolates between two views.
+func lerpView(a, b cameraView, p float64) cameraView {
+	return cameraView{anim.Lerp(a.X, b.X, p), anim.Lerp(a.Y, b.Y, p), anim.Lerp(a.Zoom, b.Zoom, p)}
+}
+
+// transform returns the scale and translation that map stage coordinates
+// on a w×h screen to the view.
+func (v cameraView) transform(w, h float64) (scale, tx, ty float64) {
+	return v.Zoom, w/2 - v.X*v.Zoom, h/2 - v.Y*v.Zoom
+}
@@ -0,0 +1,120 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"testing"
+	"time"
+
+	"novegido/internal/script"
+)
+
+func TestApplyCamera(t *testing.T) {
+	c := applyCamera(Camera{}, &script.CameraInfo{Zoom: 2})
+	if c != (Camera{X: 0.5, Y: 0.5, Zoom: 2}) {
+		t.Fatalf("zoom from the default view = %+v", c)
+	}
+	c = applyCamera(c, &script.CameraInfo{Focus: "kuro"})
+	if c.Focus != "kuro" || c.Zoom != 2 {
+		t.Fatalf("focus should keep the zoom: %+v", c)
+	}
+	c = applyCamera(c, &script.CameraInfo{X: f64p(0.2)})
+	if c.Focus != "" || c.X != 0.2 {
+		t.Fatalf("an explicit centre should drop the focus: %+v", c)
+	}
+	if c := applyCamera(c, &script.CameraInfo{Reset: true}); c != (Camera{}) {
+		t.Fatalf("reset = %+v", c)
+	}
+}
+
+func TestResolveCamera(t *testing.T) {
+	screen := stageRect{0, 0, 100, 100}
+	if v := resolveCamera(Camera{}, screen, 100, 100, nil); v != (cameraView{50, 50, 1}) {
+		t.Errorf("zero camera = %+v", v)
+	}
+	// A view half the size of the stage cannot be centred nearer than a
+	// quarter from the edge.
+	if v := resolveCamera(Camera{X: 0, Y: 1, Zoom: 2}, screen, 100, 100, nil); v != (cameraView{25, 75, 2}) {
+		t.Errorf("clamped view = %+v", v)
+	}
+	focus := func(id string) (float64, float64, bool) { return 50, 40, id == "kuro" }
+	if v := resolveCamera(Camera{X: 0.5, Y: 0.5, Zoom: 2, Focus: "kuro"}, screen, 100, 100, focus); v.Y != 40 {
+		t.Errorf("focused view = %+v", v)
+	}
+	if v := resolveCamera(Camera{X: 0.5, Y: 0.5, Zoom: 2, Focus: "siro"}, screen, 100, 100, focus); v.Y != 50 {
+		t.Errorf("missing focus should use the centre: %+v", v)
+	}
+}
+
+func TestCameraPansWideBackground(t *testing.T) {
+	// A background twice as wide as the screen is laid out at its own size
+	// with the screen in its middle.
+	world := cameraWorld(100, 50, 200, 50)
+	if world != (stageRect{-50, 0, 200, 50}) {
+		t.Fatalf("world = %+v", world)
+	}
+	// Panning end to end at zoom 1 brings each edge of the background to
+	// the matching edge of the screen.
+	s0, tx, _ := resolveCamera(Camera{X: 0, Y: 0.5, Zoom: 1}, world, 100, 50, nil).transform(100, 50)
+	if x := -50*s0 + tx; s0 != 1 || x != 0 {
+		t.Errorf("left edge at %v with zoom %v", x, s0)
+	}
+	s1, tx, _ := resolveCamera(Camera{X: 1, Y: 0.5, Zoom: 1}, world, 100, 50, nil).transform(100, 50)
+	if x := 150*s1 + tx; s1 != 1 || x != 100 {
+		t.Errorf("right edge at %v with zoom %v", x, s1)
+	}
+	if v := resolveCamera(Camera{}, world, 100, 50, nil); v != (cameraView{50, 25, 1}) {
+		t.Errorf("zero camera over a wide background = %+v", v)
+	}
+	// Zooming out is bounded by the background covering the screen.
+	if v := resolveCamera(Camera{X: 0.5, Y: 0.5, Zoom: 0.25}, world, 100, 50, nil); v.Zoom != 1 {
+		t.Errorf("zoom out past the background = %+v", v)
+	}
+}
+
+func TestCameraWorldScalesUpSmallBackground(t *testing.T) {
+	if w := cameraWorld(100, 100, 50, 100); w != (stageRect{0, -50, 100, 200}) {
+		t.Fatalf("world = %+v", w)
+	}
+}
+
+func TestCameraTransform(t *testing.T) {
+	s, tx, ty := cameraView{25, 25, 2}.transform(100, 50)
+	// The view centre (25, 25) must land on the screen centre (50, 25).
+	if x, y := 25*s+tx, 25*s+ty; x != 50 || y != 25 {
+		t.Fatalf("centre maps to (%v, %v)", x, y)
+	}
+}
+
+func TestStageCameraDrift(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{Camera: &script.CameraInfo{
+		From:       &script.CameraInfo{Zoom: 1.2, X: f64p(0.4)},
+		Zoom:       1.5,
+		DurationMs: 1000,
+	}})
+	snap := s.Snapshot()
+	if snap.CameraFrom != (Camera{X: 0.4, Y: 0.5, Zoom: 1.2}) || snap.CameraProgress != 0 {
+		t.Fatalf("drift should start from the given view: %+v", snap)
+	}
+	s.Update(500 * time.Millisecond)
+	if p := s.Snapshot().CameraProgress; p != 0.5 {
+		t.Fatalf("CameraProgress = %v, want 0.5", p)
+	}
+	if s.Transitioning() {
+		t.Fatal("a camera drift should not hold up clicks")
+	}
+	s.FinishTransitions()
+	if p := s.Snapshot().CameraProgress; p != 0.5 {
+		t.Fatalf("finishing transitions should leave the drift running, CameraProgress = %v", p)
+	}
+	state := s.State()
+	if state.Camera != (Camera{X: 0.5, Y: 0.5, Zoom: 1.5}) {
+		t.Fatalf("state camera = %+v", state.Camera)
+	}
+	s.Restore(state)
+	if snap := s.Snapshot(); snap.Camera != state.Camera || snap.CameraProgress != 1 {
+		t.Fatalf("restored camera should be still: %+v", snap)
+	}
+}
@@ -0,0 +1,53 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+
+	"novegido/internal/character"
+	"novegido/internal/script"
+)
+
+// spriteFile resolves the image file for a sprite, expanding character
+// references through the registry.
+func spriteFile(cast *character.Registry, s script.SpriteInfo) string {
+	if s.File != "" {
+		if id, expr, ok := character.SplitRef(s.File); ok {
+			return cast.SpriteFile(id, expr)
+		}
+		return s.File
+	}
+	return cast.SpriteFile(s.ID, s.Expr)
+}
+
+// spriteParts returns the images that make up a sprite, bottom first. Layered
+// characters give their composed parts; any other sprite is the single image
+// named by spriteFile.
+func spriteParts(cast *character.Registry, s script.SpriteInfo) []character.Part {
+	id, expr := s.ID, s.Expr
+	if s.File != "" {
+		var ok bool
+		if id, expr, ok = character.SplitRef(s.File); !ok {
+			return []character.Part{{File: s.File}}
+		}
+	}
+	if parts, ok := cast.Compose(id, expr, s.Layers); ok {
+		return parts
+	}
+	return []character.Part{{File: spriteFile(cast, s)}}
+}
+
+// partsKey names a composition of parts for caching.
+func partsKey(parts []character.Part) string {
+	var b strings.Builder
+	for i, p := range parts {
+		if i > 0 {
+			b.WriteByte('+')
+		}
+		b.WriteString(p.File)
+		if p.Offset != [2]float64{} {
+			fmt.Fprintf(&b, "@%g,%g", p.Offset[0], p.Offset[1])
+		}
+	}
+	return b.String()
+}
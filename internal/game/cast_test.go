@@ -0,0 +1,56 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"testing"
+
+	"novegido/internal/character"
+	"novegido/internal/script"
+)
+
+func TestSpriteFile(t *testing.T) {
+	cast := character.NewRegistry("ja", map[string]*character.Character{
+		"kuro": {Sprites: map[string]string{"smile": "kuro_joy.png"}},
+	})
+	tests := []struct {
+		name string
+		in   script.SpriteInfo
+		want string
+	}{
+		{"plain file", script.SpriteInfo{ID: "kuro", File: "other.png"}, "other.png"},
+		{"reference", script.SpriteInfo{File: "kuro:smile"}, "kuro_joy.png"},
+		{"id and expr", script.SpriteInfo{ID: "kuro", Expr: "smile"}, "kuro_joy.png"},
+		{"convention", script.SpriteInfo{ID: "siro", Expr: "wink"}, "siro_wink.png"},
+	}
+	for _, tt := range tests {
+		if got := spriteFile(cast, tt.in); got != tt.want {
+			t.Errorf("%s: spriteFile = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSpriteParts(t *testing.T) {
+	cast := character.NewRegistry("ja", map[string]*character.Character{
+		"kuro": {Layered: &character.Layered{
+			Body:  character.Part{File: "kuro/body.png"},
+			Slots: []string{"face"},
+			Parts: map[string]map[string]character.Part{
+				"face": {"joy": {File: "kuro/joy.png", Offset: [2]float64{60, 20}}},
+			},
+		}},
+	})
+	parts := spriteParts(cast, script.SpriteInfo{File: "kuro:joy"})
+	if got := partsKey(parts); got != "kuro/body.png+kuro/joy.png@60,20" {
+		t.Errorf("layered reference key = %q", got)
+	}
+	parts = spriteParts(cast, script.SpriteInfo{ID: "siro", Expr: "wink"})
+	if len(parts) != 1 || parts[0].File != "siro_wink.png" {
+		t.Errorf("plain sprite parts = %+v", parts)
+	}
+	parts = spriteParts(cast, script.SpriteInfo{ID: "kuro", File: "other.png"})
+	if len(parts) != 1 || parts[0].File != "other.png" {
+		t.Errorf("plain file parts = %+v", parts)
+	}
+}
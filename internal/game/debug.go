@@ -0,0 +1,195 @@
+//go:build debug && !headless
+// +build debug,!headless
+
+package game
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"novegido/internal/script"
+)
+
+const debugLogLines = 6
+
+// debugConsole holds the state of the developer overlay. It is toggled with
+// F12 and accepts commands typed while it is open.
+type debugConsole struct {
+	open  bool
+	input []rune
+	log   []string
+}
+
+func (c *debugConsole) print(format string, args ...interface{}) {
+	c.log = append(c.log, fmt.Sprintf(format, args...))
+	if len(c.log) > debugLogLines {
+		c.log = c.log[len(c.log)-debugLogLines:]
+	}
+}
+
+// updateDebug handles input for the overlay. It returns true while the
+// console is open so the game itself stays paused.
+func (g *Game) updateDebug() bool {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF12) {
+		g.debug.open = !g.debug.open
+		g.debug.input = g.debug.input[:0]
+		return true
+	}
+	if !g.debug.open {
+		return false
+	}
+
+	g.debug.input = ebiten.AppendInputChars(g.debug.input)
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(g.debug.input) > 0 {
+		g.debug.input = g.debug.input[:len(g.debug.input)-1]
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.debug.open = false
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		line := strings.TrimSpace(string(g.debug.input))
+		g.debug.input = g.debug.input[:0]
+		if line != "" {
+			g.debug.print("> %s", line)
+			g.execDebug(line)
+		}
+	}
+	return true
+}
+
+// execDebug runs a single console command.
+func (g *Game) execDebug(line string) {
+	args := strings.Fields(line)
+	switch args[0] {
+	case "jump":
+		if len(args) != 2 {
+			g.debug.print("usage: jump <page>")
+			return
+		}
+		dest := script.FindPage(g.pages, args[1])
+		if dest < 0 {
+			g.debug.print("no such page: %s", args[1])
+			return
+		}
+		g.choosing = false
+		g.enterPage(dest)
+	case "set":
+		if len(args) < 3 {
+			g.debug.print("usage: set <var> <value>")
+			return
+		}
+		// Variables decide which conditional choices are shown, so the
+		// selection starts over.
+		g.vars[args[1]] = strings.Join(args[2:], " ")
+		g.choiceIndex = 0
+	case "reload":
+		g.reload()
+	case "bg":
+		if len(args) != 2 {
+			g.debug.print("usage: bg <file>")
+			return
+		}
+		g.stage.SetBackground(args[1])
+	case "backlog":
+		if len(args) != 2 || args[1] != "clear" {
+			g.debug.print("usage: backlog clear")
+			return
+		}
+		g.backlog = nil
+		g.backlogOffset = 0
+	default:
+		g.debug.print("unknown command: %s", args[0])
+	}
+}
+
+// reload re-reads the script file and drops cached images.
+func (g *Game) reload() {
+	g.renderer.clearCache()
+	if g.scriptPath == "" {
+		g.debug.print("images reloaded; no script path set")
+		return
+	}
+	pages, err := script.LoadScripts(g.scriptPath)
+	if err != nil {
+		g.debug.print("reload error: %v", err)
+		return
+	}
+	if len(pages) == 0 {
+		g.debug.print("reload error: %s has no pages", g.scriptPath)
+		return
+	}
+	g.pages = pages
+	if g.index >= len(pages) {
+		g.index = len(pages) - 1
+	}
+	for i, idx := range g.history {
+		if idx >= len(pages) {
+			g.history[i] = len(pages) - 1
+		}
+	}
+	g.choosing = false
+	g.resetText()
+	g.debug.print("reloaded %d pages", len(pages))
+}
+
+func (g *Game) drawDebug(screen *ebiten.Image) {
+	if !g.debug.open {
+		ebitenutil.DebugPrint(screen, fmt.Sprintf("FPS %.1f", ebiten.ActualFPS()))
+		return
+	}
+
+	box := ebiten.NewImage(g.width, g.height)
+	box.Fill(color.RGBA{0, 0, 32, 200})
+	screen.DrawImage(box, nil)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "FPS %.1f  TPS %.1f\n", ebiten.ActualFPS(), ebiten.ActualTPS())
+	page := g.pages[g.index]
+	fmt.Fprintf(&b, "page %d/%d", g.index, len(g.pages)-1)
+	if page.Label != "" {
+		fmt.Fprintf(&b, " [%s]", page.Label)
+	}
+	b.WriteString("\n")
+
+	snap := g.stage.Snapshot()
+	fmt.Fprintf(&b, "bg %q (prev %q, %.0f%%)\n", snap.BG, snap.PrevBG, snap.BGProgress*100)
+	for _, l := range snap.Sprites {
+		s := l.Info
+		fmt.Fprintf(&b, "  sprite %s %s @%s %.0f%%\n", s.ID, partsKey(spriteParts(g.cast, s)), s.Pos, l.Alpha*100)
+	}
+	for _, p := range []struct {
+		name string
+		l    PlaneLayer
+	}{{planeForeground, snap.Foreground}, {planeCG, snap.CG}, {planeOverlay, snap.Overlay}} {
+		if p.l.File != "" || p.l.Prev != "" {
+			fmt.Fprintf(&b, "%s %q (prev %q, %.0f%%)\n", p.name, p.l.File, p.l.Prev, p.l.Progress*100)
+		}
+	}
+	r := g.renderer
+	fmt.Fprintf(&b, "cache bg=%d sprites=%d\n", len(r.bgCache), len(r.spriteCache))
+
+	playing := g.mixer.Playing()
+	fmt.Fprintf(&b, "audio %s\n", strings.Join(playing, ", "))
+
+	var names []string
+	for k := range g.vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(&b, "  %s = %s\n", k, g.vars[k])
+	}
+	fmt.Fprintf(&b, "backlog %d entries\n\n", len(g.backlog))
+
+	for _, l := range g.debug.log {
+		b.WriteString(l + "\n")
+	}
+	fmt.Fprintf(&b, "> %s_", string(g.debug.input))
+	ebitenutil.DebugPrint(screen, b.String())
+}
@@ -0,0 +1,14 @@
+//go:build !debug && !headless
+// +build !debug,!headless
+
+package game
+
+import "github.com/hajimehoshi/ebiten/v2"
+
+// debugConsole is empty in release builds; build with -tags debug to enable
+// the developer overlay.
+type debugConsole struct{}
+
+func (g *Game) updateDebug() bool { return false }
+
+func (g *Game) drawDebug(screen *ebiten.Image) {}
@@ -0,0 +1,142 @@
+package game
+
+import (
+	"image/color"
+	"math"
+	"time"
+
+	"novegido/internal/anim"
+	"novegido/internal/character"
+	"novegido/internal/script"
+)
+
+// defaultFlash is how long a flash lasts when the script gives no duration.
+const defaultFlash = 300 * time.Millisecond
+
+// ScreenEffects are the persistent screen-wide effects, saved with the
+// stage state.
+type ScreenEffects struct {
+	Filter   string  `json:"filter,omitempty"`
+	Tint     string  `json:"tint,omitempty"`
+	Vignette float64 `json:"vignette,omitempty"`
+	Blur     float64 `json:"blur,omitempty"`
+}
+
+// applyEffect returns e changed by the persistent settings of info.
+func applyEffect(e ScreenEffects, info *script.EffectInfo) ScreenEffects {
+	if info == nil {
+		return e
+	}
+	if info.Clear {
+		e = ScreenEffects{}
+	}
+	if info.Filter != nil {
+		e.Filter = *info.Filter
+	}
+	if info.Tint != nil {
+		e.Tint = *info.Tint
+	}
+	if info.Vignette != nil {
+		e.Vignette = *info.Vignette
+	}
+	if info.Blur != nil {
+		e.Blur = *info.Blur
+	}
+	return e
+}
+
+// EffectLevels are screen effects resolved to strengths so that they can be
+// blended while fading. Tint is not premultiplied; its alpha is the
+// strength.
+type EffectLevels struct {
+	Sepia     float64
+	Grayscale float64
+	Tint      color.RGBA
+	Vignette  float64
+	Blur      float64
+}
+
+// Active reports whether drawing the levels changes anything.
+func (l EffectLevels) Active() bool {
+	return l.Sepia > 0 || l.Grayscale > 0 || l.Tint.A > 0 || l.Vignette > 0 || l.Blur > 0
+}
+
+func effectLevels(e ScreenEffects) EffectLevels {
+	l := EffectLevels{Vignette: e.Vignette, Blur: e.Blur}
+	switch e.Filter {
+	case script.FilterSepia:
+		l.Sepia = 1
+	case script.FilterGrayscale:
+		l.Grayscale = 1
+	}
+	if e.Tint != "" {
+		// Bad colours are reported by script.Lint; here they are ignored.
+		if c, err := character.ParseColor(e.Tint); err == nil {
+			l.Tint = c
+		}
+	}
+	return l
+}
+
+// blendEffects interpolates from the effects a to b at progress p. A tint
+// that appears or disappears keeps its colour and only changes strength.
+func blendEffects(a, b ScreenEffects, p float64) EffectLevels {
+	la, lb := effectLevels(a), effectLevels(b)
+	if la.Tint.A == 0 {
+		la.Tint = color.RGBA{lb.Tint.R, lb.Tint.G, lb.Tint.B, 0}
+	}
+	if lb.Tint.A == 0 {
+		lb.Tint = color.RGBA{la.Tint.R, la.Tint.G, la.Tint.B, 0}
+	}
+	lerp8 := func(x, y uint8) uint8 { return uint8(anim.Lerp(float64(x), float64(y), p) + 0.5) }
+	return EffectLevels{
+		Sepia:     anim.Lerp(la.Sepia, lb.Sepia, p),
+		Grayscale: anim.Lerp(la.Grayscale, lb.Grayscale, p),
+		Tint: color.RGBA{
+			lerp8(la.Tint.R, lb.Tint.R), lerp8(la.Tint.G, lb.Tint.G),
+			lerp8(la.Tint.B, lb.Tint.B), lerp8(la.Tint.A, lb.Tint.A),
+		},
+		Vignette: anim.Lerp(la.Vignette, lb.Vignette, p),
+		Blur:     anim.Lerp(la.Blur, lb.Blur, p),
+	}
+}
+
+var (
+	sepiaMatrix = [3][3]float64{
+		{0.393, 0.769, 0.189},
+		{0.349, 0.686, 0.168},
+		{0.272, 0.534, 0.131},
+	}
+	grayMatrix = [3][3]float64{
+		{0.299, 0.587, 0.114},
+		{0.299, 0.587, 0.114},
+		{0.299, 0.587, 0.114},
+	}
+)
+
+// filterMatrix returns the colour matrix that applies the sepia and
+// grayscale filters of l at their strengths.
+func filterMatrix(l EffectLevels) [3][3]float64 {
+	var m [3][3]float64
+	id := 1 - l.Sepia - l.Grayscale
+	if id < 0 {
+		id = 0
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			m[i][j] = l.Sepia*sepiaMatrix[i][j] + l.Grayscale*grayMatrix[i][j]
+		}
+		m[i][i] += id
+	}
+	return m
+}
+
+// vignetteAlpha returns the darkening at pixel (x, y) of a w×h vignette at
+// full strength: none inside half the distance to the corners, rising
+// smoothly to opaque at the corners.
+func vignetteAlpha(x, y, w, h int) float64 {
+	cx, cy := float64(w)/2, float64(h)/2
+	d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy) / math.Hypot(cx, cy)
+	t := math.Max(0, math.Min(1, (d-0.5)/0.5))
+	return t * t * (3 - 2*t)
+}
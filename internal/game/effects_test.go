@@ -0,0 +1,112 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"image/color"
+	"testing"
+	"time"
+
+	"novegido/internal/script"
+)
+
+func strp(s string) *string   { return &s }
+func f64p(f float64) *float64 { return &f }
+
+func TestApplyEffect(t *testing.T) {
+	e := applyEffect(ScreenEffects{}, &script.EffectInfo{Filter: strp("sepia"), Vignette: f64p(0.5)})
+	e = applyEffect(e, &script.EffectInfo{Tint: strp("#ff000080")})
+	want := ScreenEffects{Filter: "sepia", Tint: "#ff000080", Vignette: 0.5}
+	if e != want {
+		t.Fatalf("effects = %+v, want %+v", e, want)
+	}
+	e = applyEffect(e, &script.EffectInfo{Clear: true, Blur: f64p(2)})
+	if e != (ScreenEffects{Blur: 2}) {
+		t.Fatalf("clear should reset earlier effects: %+v", e)
+	}
+	if got := applyEffect(e, nil); got != e {
+		t.Fatalf("nil info should keep effects")
+	}
+}
+
+func TestBlendEffects(t *testing.T) {
+	l := blendEffects(ScreenEffects{}, ScreenEffects{Filter: "grayscale", Tint: "#ff0000", Blur: 4}, 0.5)
+	if l.Grayscale != 0.5 || l.Blur != 2 {
+		t.Errorf("levels = %+v", l)
+	}
+	if l.Tint != (color.RGBA{255, 0, 0, 128}) {
+		t.Errorf("tint should keep its colour while fading in: %v", l.Tint)
+	}
+	if blendEffects(ScreenEffects{}, ScreenEffects{}, 1).Active() {
+		t.Errorf("no effects should be inactive")
+	}
+}
+
+func TestFilterMatrix(t *testing.T) {
+	m := filterMatrix(EffectLevels{})
+	if m != [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}} {
+		t.Errorf("no filter should be identity: %v", m)
+	}
+	if m := filterMatrix(EffectLevels{Grayscale: 1}); m != grayMatrix {
+		t.Errorf("grayscale = %v", m)
+	}
+	m = filterMatrix(EffectLevels{Sepia: 0.5})
+	if got, want := m[0][0], 0.5+0.5*sepiaMatrix[0][0]; got != want {
+		t.Errorf("half sepia m[0][0] = %v, want %v", got, want)
+	}
+}
+
+func TestVignetteAlpha(t *testing.T) {
+	if a := vignetteAlpha(50, 50, 100, 100); a != 0 {
+		t.Errorf("centre = %v, want 0", a)
+	}
+	if a := vignetteAlpha(0, 0, 100, 100); a < 0.9 {
+		t.Errorf("corner = %v, want nearly opaque", a)
+	}
+}
+
+func TestStageEffectsPersistAndFade(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{Effect: &script.EffectInfo{Filter: strp("sepia"), FadeMs: 100}})
+	s.Update(50 * time.Millisecond)
+	if got := s.Snapshot().Effects.Sepia; got != 0.5 {
+		t.Fatalf("sepia while fading in = %v, want 0.5", got)
+	}
+	s.Update(50 * time.Millisecond)
+	s.Apply(&script.StageInfo{BG: "b.png"})
+	if got := s.Snapshot().Effects.Sepia; got != 1 {
+		t.Fatalf("sepia should persist across pages, got %v", got)
+	}
+	state := s.State()
+	if state.Effects.Filter != "sepia" {
+		t.Fatalf("state should record effects: %+v", state)
+	}
+	s.Restore(StageState{})
+	if s.Snapshot().Effects.Active() {
+		t.Fatalf("restore should clear effects")
+	}
+	s.Restore(state)
+	if got := s.Snapshot().Effects.Sepia; got != 1 {
+		t.Fatalf("restored sepia = %v, want 1", got)
+	}
+}
+
+func TestStageFlash(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{Effect: &script.EffectInfo{Flash: "#ff0000", FlashMs: 100}})
+	snap := s.Snapshot()
+	if snap.Flash != "#ff0000" || snap.FlashAlpha != 1 {
+		t.Fatalf("flash should start opaque: %+v", snap)
+	}
+	if !s.Transitioning() {
+		t.Fatalf("flash should count as transitioning")
+	}
+	s.FinishTransitions()
+	if snap := s.Snapshot(); snap.FlashAlpha != 0 || snap.Flash != "" {
+		t.Fatalf("finished flash should be gone: %+v", snap)
+	}
+	if s.State().Effects != (ScreenEffects{}) {
+		t.Fatalf("flash should not persist")
+	}
+}
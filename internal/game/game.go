@@ -7,17 +7,18 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"io"
 	"log"
-	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/audio"
-	"github.com/hajimehoshi/ebiten/v2/audio/mp3"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/text/v2"
 
+	"novegido/internal/character"
+	"novegido/internal/linebreak"
+	"novegido/internal/project"
 	"novegido/internal/script"
 	uipkg "novegido/internal/ui"
 )
@@ -26,27 +27,29 @@ import (
 type DialogueEntry struct {
 	Speaker string
 	Text    string
+	// step is the position in the visit history that produced the entry,
+	// so rolling back can drop the lines that are being undone.
+	step int
 }
 
-type mp3Source struct {
-	*mp3.Stream
-	f *os.File
-}
-
-func (m *mp3Source) Close() error { return m.f.Close() }
-
 // Game holds all runtime state for the visual novel.
 type Game struct {
 	pages         []*script.Page
 	index         int
-	stage         *StageRenderer
+	history       []int
+	stageHistory  []StageState
+	stage         *Stage
+	particles     *ParticleField
+	renderer      *StageRenderer
 	dialogueBox   uipkg.DialogueBox
+	verticalBox   uipkg.VerticalBox
+	nvlPanel      uipkg.NVLPanel
 	ui            *uipkg.UI
-	audioCtx      *audio.Context
-	players       map[string]*audio.Player
-	sources       map[string]io.Closer
-	bgm           *audio.Player
-	bgmFile       string
+	cast          *character.Registry
+	cfg           *project.Config
+	mixer         *Mixer
+	audioHistory  []MixerState
+	canvas        *ebiten.Image
 	width         int
 	height        int
 	backlog       []DialogueEntry
@@ -54,6 +57,15 @@ type Game struct {
 	backlogOffset int
 	choosing      bool
 	choiceIndex   int
+	textPages     [][]uipkg.Line
+	textFor       int
+	textPage      int
+	// talkLeft is how much longer the current line counts as being spoken
+	// when it has no voice.
+	talkLeft   time.Duration
+	scriptPath string
+	vars       map[string]string
+	debug      debugConsole
 }
 
 func (g *Game) addToBacklog(d *script.DialogueInfo) {
@@ -61,55 +73,163 @@ func (g *Game) addToBacklog(d *script.DialogueInfo) {
 		return
 	}
 	g.backlog = append(g.backlog, DialogueEntry{
-		Speaker: d.Speaker,
+		Speaker: g.cast.DisplayName(d.Speaker),
 		Text:    script.ParseDialogue(d.Text),
+		step:    len(g.history) - 1,
 	})
 }
 
-// NewGame creates a Game instance with the provided pages and screen size.
-func NewGame(ui *uipkg.UI, pages []*script.Page, w, h int) *Game {
+// NewGame creates a Game instance with the provided pages, project settings
+// and cast. The game is always drawn at the project's logical size and
+// scaled to fit the window.
+func NewGame(ui *uipkg.UI, pages []*script.Page, cfg *project.Config, cast *character.Registry) *Game {
 	frame, err := uipkg.LoadNineSlice(filepath.Join("assets", "ui", "9slice30.png"), 30)
 	if err != nil {
 		log.Printf("nine-slice load error: %v", err)
 	}
+	emitters, err := LoadEmitters(cfg.Particles)
+	if err != nil {
+		log.Printf("particle load error: %v", err)
+	}
 	g := &Game{
-		pages: pages,
-		stage: NewStageRenderer(w, h),
+		pages:     pages,
+		stage:     NewStage(),
+		particles: NewParticleField(emitters, cfg.Width, cfg.Height),
 		dialogueBox: uipkg.DialogueBox{
-			Rect:      image.Rect(0, h*2/3, w, h),
 			Frame:     frame,
 			NameFrame: frame,
+			LineBreak: linebreak.Options{Hanging: cfg.HangingPunctuation},
+		},
+		verticalBox: uipkg.VerticalBox{
+			Frame:     frame,
+			LineBreak: linebreak.Options{Hanging: cfg.HangingPunctuation},
+		},
+		nvlPanel: uipkg.NVLPanel{
+			LineBreak: linebreak.Options{Hanging: cfg.HangingPunctuation},
 		},
 		ui:          ui,
-		audioCtx:    audio.NewContext(48000),
-		players:     map[string]*audio.Player{},
-		sources:     map[string]io.Closer{},
-		width:       w,
-		height:      h,
+		cast:        cast,
+		cfg:         cfg,
+		mixer:       NewMixer(audio.NewContext(48000)),
 		choiceIndex: 0,
+		textFor:     -1,
+		vars:        map[string]string{},
 	}
+	g.SetLogicalSize(cfg.Width, cfg.Height)
 	if len(pages) > 0 {
-		g.playAudio(pages[0].Audio)
-		g.addToBacklog(pages[0].Dialogue)
+		g.enterPage(0)
 	}
 	return g
 }
 
+// SetLogicalSize changes the resolution the game is drawn at and recomputes
+// every layout that depends on it.
+func (g *Game) SetLogicalSize(w, h int) {
+	g.width = w
+	g.height = h
+	g.canvas = ebiten.NewImage(w, h)
+	g.renderer = NewStageRenderer(w, h, g.cast, g.cfg)
+	g.particles.SetBounds(w, h)
+	g.dialogueBox.Rect = image.Rect(0, h*2/3, w, h)
+	g.verticalBox.Rect = image.Rect(w/2, 0, w, h)
+	g.nvlPanel.Rect = image.Rect(0, 0, w, h)
+	g.resetText()
+}
+
+// resetText discards the laid-out dialogue so it is recomputed for the
+// current page, starting from its first text page.
+func (g *Game) resetText() {
+	g.textPages = nil
+	g.textFor = -1
+	g.textPage = 0
+	g.talkLeft = talkDuration(g.pages[g.index].Clean)
+}
+
+// talking reports whether the current speaker is still speaking: its voice
+// is playing or its line was entered only moments ago.
+func (g *Game) talking() bool {
+	return g.talkLeft > 0 || g.mixer.VoicePlaying()
+}
+
+// nvl reports whether the current page is presented in NVL mode.
+func (g *Game) nvl() bool {
+	return g.pages[g.index].Mode == script.ModeNVL
+}
+
+// vertical reports whether the current page sets its text vertically.
+func (g *Game) vertical() bool {
+	return g.pages[g.index].Writing == script.WritingVertical
+}
+
+// dialoguePages returns the current page's dialogue wrapped and paginated to
+// fit the dialogue box, or into columns when the page is set vertically.
+func (g *Game) dialoguePages() [][]uipkg.Line {
+	if g.textFor != g.index {
+		g.textPages = nil
+		page := g.pages[g.index]
+		if dlg := page.Dialogue; dlg != nil {
+			if g.vertical() {
+				g.textPages = g.verticalBox.Layout(g.ui.Face, g.speaker(dlg), page.Clean)
+			} else {
+				g.textPages = g.dialogueBox.Layout(g.ui.Face, g.speaker(dlg), page.Clean)
+			}
+		}
+		g.textFor = g.index
+	}
+	return g.textPages
+}
+
+// SetScriptPath records the file the pages were loaded from so they can be
+// reloaded at runtime.
+func (g *Game) SetScriptPath(path string) { g.scriptPath = path }
+
+// enterPage moves to page dest and records the visit so it can be rolled
+// back.
+func (g *Game) enterPage(dest int) {
+	g.index = dest
+	g.history = append(g.history, dest)
+	g.stage.Apply(g.pages[dest].Stage)
+	state := g.stage.State()
+	g.stageHistory = append(g.stageHistory, state)
+	g.particles.Set(state.Particles)
+	g.resetText()
+	g.mixer.Play(g.pages[dest].Audio)
+	g.audioHistory = append(g.audioHistory, g.mixer.State())
+	g.playVoice(g.pages[g.index].Dialogue)
+	g.addToBacklog(g.pages[g.index].Dialogue)
+}
+
 func (g *Game) nextPage() {
 	if g.index >= len(g.pages)-1 {
 		return
 	}
-	g.index++
-	g.playAudio(g.pages[g.index].Audio)
-	g.addToBacklog(g.pages[g.index].Dialogue)
+	g.enterPage(g.index + 1)
 }
 
+// prevPage rolls back to the previously visited page. Backlog lines from the
+// page being left are dropped so that reading forward again does not
+// duplicate them, the stage is restored as it was on that page and the NVL
+// panel is rebuilt from the shortened history.
 func (g *Game) prevPage() {
-	if g.index <= 0 {
+	if len(g.history) <= 1 {
 		return
 	}
-	g.index--
-	g.playAudio(g.pages[g.index].Audio)
+	g.history = g.history[:len(g.history)-1]
+	g.stageHistory = g.stageHistory[:len(g.stageHistory)-1]
+	g.audioHistory = g.audioHistory[:len(g.audioHistory)-1]
+	g.index = g.history[len(g.history)-1]
+	state := g.stageHistory[len(g.stageHistory)-1]
+	g.stage.Restore(state)
+	g.particles.Set(state.Particles)
+	g.mixer.Restore(g.audioHistory[len(g.audioHistory)-1])
+	for len(g.backlog) > 0 && g.backlog[len(g.backlog)-1].step >= len(g.history) {
+		g.backlog = g.backlog[:len(g.backlog)-1]
+	}
+	if g.backlogOffset >= len(g.backlog) {
+		g.backlogOffset = 0
+	}
+	g.resetText()
+	g.playVoice(g.pages[g.index].Dialogue)
 }
 
 func (g *Game) updateBacklog() bool {
@@ -134,12 +254,17 @@ func (g *Game) updateBacklog() bool {
 	return false
 }
 
+// choices returns the choices of the current page whose conditions hold.
+func (g *Game) choices() []script.ChoiceInfo {
+	return script.VisibleChoices(g.pages[g.index].Choices, g.vars)
+}
+
 func (g *Game) updateChoiceSelection() bool {
 	if !g.choosing {
 		return false
 	}
 
-	choices := g.pages[g.index].Choices
+	choices := g.choices()
 	if len(choices) == 0 {
 		g.choosing = false
 		return true
@@ -162,9 +287,7 @@ func (g *Game) updateChoiceSelection() bool {
 	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
 		dest := choices[g.choiceIndex].Page
 		if dest >= 0 && dest < len(g.pages) {
-			g.index = dest
-			g.playAudio(g.pages[g.index].Audio)
-			g.addToBacklog(g.pages[g.index].Dialogue)
+			g.enterPage(dest)
 		}
 		g.choosing = false
 	}
@@ -176,6 +299,16 @@ func (g *Game) handlePageInput() {
 		g.prevPage()
 	}
 
+	if ebiten.IsKeyPressed(ebiten.KeyControl) {
+		// Holding Ctrl skips: transitions finish instantly and pages advance
+		// every tick until a choice is reached.
+		g.stage.FinishTransitions()
+		if len(g.choices()) == 0 {
+			g.nextPage()
+		}
+		return
+	}
+
 	trigger := inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) ||
 		inpututil.IsKeyJustPressed(ebiten.KeySpace) ||
 		inpututil.IsKeyJustPressed(ebiten.KeyEnter)
@@ -192,7 +325,16 @@ func (g *Game) handlePageInput() {
 	}
 
 	if trigger {
-		if len(g.pages[g.index].Choices) > 0 {
+		// A click during a transition or motion only completes it.
+		if g.stage.Transitioning() {
+			g.stage.FinishTransitions()
+			return
+		}
+		if !g.nvl() && g.textPage < len(g.dialoguePages())-1 {
+			g.textPage++
+			return
+		}
+		if len(g.choices()) > 0 {
 			g.choosing = true
 			g.choiceIndex = 0
 			return
@@ -201,8 +343,42 @@ func (g *Game) handlePageInput() {
 	}
 }
 
+// tickDuration reports the simulated time that passes during one Update call.
+func tickDuration() time.Duration {
+	return time.Second / time.Duration(ebiten.TPS())
+}
+
 // Update advances the game state according to user input.
 func (g *Game) Update() error {
+	if g.updateDebug() {
+		return nil
+	}
+	g.mixer.Update(tickDuration())
+
+	if g.updateFullscreen() {
+		return nil
+	}
+
+	if g.updateSaves() {
+		return nil
+	}
+
+	// The stage, and with it every transition and animation, is paused
+	// while the backlog is open.
+	if !g.showBacklog {
+		dt := tickDuration()
+		speaker := ""
+		if d := g.pages[g.index].Dialogue; d != nil {
+			speaker = d.Speaker
+		}
+		g.stage.SetSpeaker(speaker, time.Duration(g.cfg.Highlight.FadeMs)*time.Millisecond)
+		g.stage.Update(dt)
+		g.particles.Update(dt)
+		if g.talkLeft > 0 {
+			g.talkLeft -= dt
+		}
+	}
+
 	if g.updateBacklog() {
 		return nil
 	}
@@ -215,23 +391,125 @@ func (g *Game) Update() error {
 	return nil
 }
 
-// Draw renders the current frame.
+// updateFullscreen toggles fullscreen with F11 or Alt+Enter.
+func (g *Game) updateFullscreen() bool {
+	alt := ebiten.IsKeyPressed(ebiten.KeyAlt)
+	if inpututil.IsKeyJustPressed(ebiten.KeyF11) || (alt && inpututil.IsKeyJustPressed(ebiten.KeyEnter)) {
+		ebiten.SetFullscreen(!ebiten.IsFullscreen())
+		return true
+	}
+	return false
+}
+
+// updateSaves writes the quick save slot with F5 and loads it with F9.
+func (g *Game) updateSaves() bool {
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyF5):
+		if err := WriteSave(quickSavePath, g.saveData()); err != nil {
+			log.Printf("save error: %v", err)
+		}
+		return true
+	case inpututil.IsKeyJustPressed(ebiten.KeyF9):
+		d, err := ReadSave(quickSavePath, len(g.pages))
+		if err != nil {
+			log.Printf("load error: %v", err)
+			return true
+		}
+		g.load(d)
+		return true
+	}
+	return false
+}
+
+// saveData records the game so far for a save file.
+func (g *Game) saveData() *SaveData {
+	d := &SaveData{
+		History: g.history,
+		Stages:  g.stageHistory,
+		Audio:   g.audioHistory,
+		Vars:    g.vars,
+	}
+	for _, e := range g.backlog {
+		d.Backlog = append(d.Backlog, SavedLine{Speaker: e.Speaker, Text: e.Text, Step: e.step})
+	}
+	return d
+}
+
+// load resumes the game from d, which must already be checked against the
+// script. The stage, with its particle emitters, is restored without
+// transitions, the mixer picks up the saved tracks and volumes and the
+// page's voice plays again.
+func (g *Game) load(d *SaveData) {
+	g.history = d.History
+	g.stageHistory = d.Stages
+	g.audioHistory = d.Audio
+	g.index = g.history[len(g.history)-1]
+	g.vars = d.Vars
+	if g.vars == nil {
+		g.vars = map[string]string{}
+	}
+	g.backlog = nil
+	for _, l := range d.Backlog {
+		g.backlog = append(g.backlog, DialogueEntry{Speaker: l.Speaker, Text: l.Text, step: l.Step})
+	}
+	g.backlogOffset = 0
+	g.showBacklog = false
+	g.choosing = false
+	state := g.stageHistory[len(g.stageHistory)-1]
+	g.stage.Restore(state)
+	g.particles.Set(state.Particles)
+	g.mixer.Restore(g.audioHistory[len(g.audioHistory)-1])
+	g.resetText()
+	g.playVoice(g.pages[g.index].Dialogue)
+}
+
+// Draw renders the current frame to the logical canvas and scales it into
+// the window, letterboxing whatever space is left over.
 func (g *Game) Draw(screen *ebiten.Image) {
-	g.stage.draw(screen, g.pages[g.index].Stage)
+	sw, sh := screen.Bounds().Dx(), screen.Bounds().Dy()
+	vp := fitViewport(g.width, g.height, sw, sh)
+	g.renderer.setRenderScale(vp.Scale)
+
+	g.canvas.Clear()
+	g.drawCanvas(g.canvas)
+
+	screen.Fill(color.Black)
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(vp.Scale, vp.Scale)
+	op.GeoM.Translate(vp.X, vp.Y)
+	op.Filter = ebiten.FilterLinear
+	screen.DrawImage(g.canvas, op)
+}
+
+func (g *Game) drawCanvas(screen *ebiten.Image) {
+	snap := g.stage.Snapshot()
+	if d := g.pages[g.index].Dialogue; d != nil {
+		snap.Speaker = d.Speaker
+		snap.Talking = g.talking()
+	}
+	snap.Particles = g.particles.Particles()
+	g.renderer.draw(screen, snap)
 
 	if g.showBacklog {
 		g.drawBacklog(screen)
-		return
-	}
+	} else {
+		if g.nvl() {
+			g.drawNVL(screen)
+		} else if dlg := g.pages[g.index].Dialogue; dlg != nil {
+			pages := g.dialoguePages()
+			if g.vertical() {
+				g.verticalBox.Draw(screen, g.ui.Face, g.ui.RubyFace, g.speaker(dlg), pages[g.textPage], g.pages[g.index].Ruby)
+			} else {
+				g.dialogueBox.Draw(screen, g.ui.Face, g.speaker(dlg), pages[g.textPage])
+			}
+		}
 
-	if g.pages[g.index].Dialogue != nil {
-		dlg := g.pages[g.index].Dialogue
-		g.dialogueBox.Draw(screen, g.ui.Face, dlg.Speaker, g.pages[g.index].Clean)
+		if g.choosing {
+			g.drawChoices(screen)
+		}
 	}
 
-	if g.choosing {
-		g.drawChoices(screen)
-	}
+	g.drawDebug(screen)
 }
 
 func (g *Game) drawBacklog(screen *ebiten.Image) {
@@ -239,21 +517,58 @@ func (g *Game) drawBacklog(screen *ebiten.Image) {
 	box.Fill(color.RGBA{0, 0, 0, 220})
 	screen.DrawImage(box, nil)
 
-	lines := g.height / 24
+	lineH := uipkg.LineHeight(g.ui.Face)
+	width := float64(g.width - 40)
+	measure := uipkg.Measure(g.ui.Face)
 	start := len(g.backlog) - 1 - g.backlogOffset
 	y := float64(20)
-	for i := 0; i < lines && start-i >= 0; i++ {
-		e := g.backlog[start-i]
-		tOp := &text.DrawOptions{}
-		tOp.GeoM.Translate(20, y)
-		tOp.ColorScale.ScaleWithColor(color.White)
-		text.Draw(screen, fmt.Sprintf("%s: %s", e.Speaker, e.Text), g.ui.Face, tOp)
-		y += 24
+	for i := start; i >= 0 && y+lineH <= float64(g.height); i-- {
+		e := g.backlog[i]
+		lines := linebreak.Wrap(fmt.Sprintf("%s: %s", e.Speaker, e.Text), width, measure, g.dialogueBox.LineBreak)
+		for _, line := range lines {
+			if y+lineH > float64(g.height) {
+				break
+			}
+			tOp := &text.DrawOptions{}
+			tOp.GeoM.Translate(20, y)
+			tOp.ColorScale.ScaleWithColor(color.White)
+			text.Draw(screen, line, g.ui.Face, tOp)
+			y += lineH
+		}
 	}
 }
 
+func (g *Game) drawNVL(screen *ebiten.Image) {
+	var entries []uipkg.NVLEntry
+	for _, idx := range nvlPages(g.pages, g.history) {
+		p := g.pages[idx]
+		entries = append(entries, uipkg.NVLEntry{Speaker: g.speaker(p.Dialogue), Text: p.Clean})
+	}
+	g.nvlPanel.Draw(screen, g.ui.Face, entries)
+}
+
+// speaker resolves the display name, colours and portrait for a line of
+// dialogue through the character registry.
+func (g *Game) speaker(d *script.DialogueInfo) uipkg.Speaker {
+	sp := uipkg.Speaker{Name: g.cast.DisplayName(d.Speaker)}
+	c := g.cast.Get(d.Speaker)
+	if c == nil {
+		return sp
+	}
+	if c.NameColor.Set {
+		sp.NameColor = c.NameColor.RGBA
+	}
+	if c.TextColor.Set {
+		sp.TextColor = c.TextColor.RGBA
+	}
+	if file := g.cast.PortraitFile(d.Speaker, d.Expr); file != "" {
+		sp.Portrait = g.renderer.portrait(file)
+	}
+	return sp
+}
+
 func (g *Game) drawChoices(screen *ebiten.Image) {
-	choices := g.pages[g.index].Choices
+	choices := g.choices()
 	if len(choices) == 0 {
 		return
 	}
@@ -270,71 +585,27 @@ func (g *Game) drawChoices(screen *ebiten.Image) {
 	}
 }
 
-// Layout reports the game's screen dimensions.
-func (g *Game) Layout(w, h int) (int, int) { return g.width, g.height }
-
-func (g *Game) playAudio(info *script.AudioInfo) {
-	if info == nil || info.File == "" {
-		return
-	}
-
-	if p, ok := g.players[info.File]; ok {
-		_ = p.Rewind()
-		if info.Loop {
-			if g.bgm != nil && g.bgm != p {
-				g.bgm.Pause()
-				g.bgmFile = info.File
-			}
-			g.bgm = p
-		}
-		p.Play()
-		return
-	}
-
-	f, err := os.Open(filepath.Join("assets", info.File))
-	if err != nil {
-		log.Printf("audio load error: %v", err)
-		return
-	}
-	stream, err := mp3.DecodeWithoutResampling(f)
-	if err != nil {
-		log.Printf("decode error: %v", err)
-		_ = f.Close()
-		return
-	}
-	src := &mp3Source{Stream: stream, f: f}
-	var reader io.ReadSeeker = src
-	if info.Loop {
-		reader = audio.NewInfiniteLoop(reader, stream.Length())
-	}
-	p, err := g.audioCtx.NewPlayer(reader)
-	if err != nil {
-		log.Printf("player error: %v", err)
-		_ = src.Close()
-		return
-	}
-	g.players[info.File] = p
-	g.sources[info.File] = src
-	if info.Loop {
-		if g.bgm != nil && g.bgm != p {
-			g.discardPlayer(g.bgmFile)
-		}
-		g.bgm = p
-		g.bgmFile = info.File
-	}
-	p.Play()
+// Layout reports the size of the screen in device pixels so that scaling the
+// canvas stays sharp on HiDPI displays.
+func (g *Game) Layout(w, h int) (int, int) {
+	s := ebiten.Monitor().DeviceScaleFactor()
+	return int(float64(w) * s), int(float64(h) * s)
 }
 
-func (g *Game) discardPlayer(file string) {
-	if file == "" {
+// playVoice plays the voice line of d, if any, using the speaker's default
+// voice directory and volume. A new line always cuts off the previous one.
+func (g *Game) playVoice(d *script.DialogueInfo) {
+	if d == nil || d.Voice == "" {
+		g.mixer.StopVoice()
 		return
 	}
-	if p, ok := g.players[file]; ok {
-		p.Close()
-		delete(g.players, file)
-	}
-	if s, ok := g.sources[file]; ok {
-		s.Close()
-		delete(g.sources, file)
+	file := d.Voice
+	volume := 1.0
+	if c := g.cast.Get(d.Speaker); c != nil {
+		file = filepath.Join(c.Voice.Dir, d.Voice)
+		if c.Voice.Volume > 0 {
+			volume = c.Voice.Volume
+		}
 	}
+	g.mixer.PlayVoice(file, volume)
 }
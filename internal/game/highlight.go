@@ -0,0 +1,73 @@
+package game
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"novegido/internal/anim"
+	"novegido/internal/character"
+	"novegido/internal/project"
+	"novegido/internal/script"
+)
+
+// bobPeriod is how long one bob of a talking, highlighted speaker takes.
+const bobPeriod = 600 * time.Millisecond
+
+// spriteTone is the brightness and saturation a sprite is drawn with, both
+// 1 for an unchanged sprite.
+type spriteTone struct {
+	Bright, Sat float64
+}
+
+// highlightTone returns the tone of a sprite with the given highlight
+// level under the project settings h.
+func highlightTone(h project.Highlight, level float64) spriteTone {
+	if !h.Enabled {
+		return spriteTone{1, 1}
+	}
+	return spriteTone{
+		Bright: anim.Lerp(1-h.Dim, 1, level),
+		Sat:    anim.Lerp(1-h.Desaturate, 1, level),
+	}
+}
+
+// highlightBob returns the vertical offset of a talking speaker at clock,
+// scaled by its highlight level so that it settles as the highlight fades.
+func highlightBob(h project.Highlight, level float64, clock time.Duration) float64 {
+	if !h.Enabled || h.Bob == 0 {
+		return 0
+	}
+	phase := float64(clock%bobPeriod) / float64(bobPeriod)
+	return -h.Bob * level * math.Abs(math.Sin(math.Pi*phase))
+}
+
+// spriteCharacter returns the registry character sprite s shows: the one
+// its file refers to, such as "kuro" for "kuro:joy", or else its ID.
+func spriteCharacter(s script.SpriteInfo) string {
+	if id, _, ok := character.SplitRef(s.File); ok {
+		return id
+	}
+	return s.ID
+}
+
+// isSpeaker reports whether sprite s is the character speaker, matched by
+// the character it shows or by its ID.
+func isSpeaker(s script.SpriteInfo, speaker string) bool {
+	return speaker != "" && (s.ID == speaker || spriteCharacter(s) == speaker)
+}
+
+// speakerToFront reorders layers so that the speaker's come after other
+// sprites of the same z-order. Layers must already be sorted by z-order.
+func speakerToFront(layers []SpriteLayer, speaker string) {
+	if speaker == "" {
+		return
+	}
+	sort.SliceStable(layers, func(i, j int) bool {
+		a, b := layers[i], layers[j]
+		if a.Info.Z != b.Info.Z {
+			return a.Info.Z < b.Info.Z
+		}
+		return !isSpeaker(a.Info, speaker) && isSpeaker(b.Info, speaker)
+	})
+}
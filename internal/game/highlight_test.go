@@ -0,0 +1,103 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"testing"
+	"time"
+
+	"novegido/internal/project"
+	"novegido/internal/script"
+)
+
+func TestHighlightTone(t *testing.T) {
+	h := project.Highlight{Enabled: true, Dim: 0.4, Desaturate: 1}
+	if got := highlightTone(h, 1); got != (spriteTone{1, 1}) {
+		t.Errorf("speaker tone = %+v", got)
+	}
+	if got := highlightTone(h, 0); got != (spriteTone{0.6, 0}) {
+		t.Errorf("listener tone = %+v", got)
+	}
+	h.Enabled = false
+	if got := highlightTone(h, 0); got != (spriteTone{1, 1}) {
+		t.Errorf("disabled tone = %+v", got)
+	}
+}
+
+func TestHighlightBob(t *testing.T) {
+	h := project.Highlight{Enabled: true, Bob: 4}
+	if got := highlightBob(h, 1, bobPeriod/2); got != -4 {
+		t.Errorf("bob at its peak = %v, want -4", got)
+	}
+	if got := highlightBob(h, 0.5, bobPeriod/2); got != -2 {
+		t.Errorf("bob while fading = %v, want -2", got)
+	}
+}
+
+func TestSpeakerToFront(t *testing.T) {
+	layers := []SpriteLayer{
+		{Info: script.SpriteInfo{ID: "a"}},
+		{Info: script.SpriteInfo{ID: "b"}},
+		{Info: script.SpriteInfo{ID: "c"}},
+		{Info: script.SpriteInfo{ID: "d", Z: 1}},
+	}
+	speakerToFront(layers, "a")
+	var got string
+	for _, l := range layers {
+		got += l.Info.ID
+	}
+	if got != "bcad" {
+		t.Errorf("order = %s, want bcad", got)
+	}
+}
+
+func TestSpeakerByCharacter(t *testing.T) {
+	k1 := script.SpriteInfo{ID: "k1", File: "kuro:joy"}
+	if !isSpeaker(k1, "kuro") || isSpeaker(k1, "siro") || isSpeaker(k1, "") {
+		t.Fatal("a sprite should be matched by the character its file refers to")
+	}
+	layers := []SpriteLayer{{Info: k1}, {Info: script.SpriteInfo{ID: "s1", File: "siro:joy"}}}
+	speakerToFront(layers, "kuro")
+	if layers[1].Info.ID != "k1" {
+		t.Errorf("speaker by character should come to the front: %+v", layers)
+	}
+
+	s := NewStage()
+	s.Apply(&script.StageInfo{Sprites: []script.SpriteInfo{k1, {ID: "s1", File: "siro:joy"}}})
+	s.SetSpeaker("kuro", 0)
+	s.Update(0)
+	for _, l := range s.Snapshot().Sprites {
+		if want := map[string]float64{"k1": 1, "s1": 0}[l.Info.ID]; l.Highlight != want {
+			t.Errorf("%s highlight = %v, want %v", l.Info.ID, l.Highlight, want)
+		}
+	}
+}
+
+func TestStageHighlight(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{Sprites: []script.SpriteInfo{{ID: "a"}, {ID: "b"}}})
+	level := func(id string) float64 {
+		for _, l := range s.Snapshot().Sprites {
+			if l.Info.ID == id {
+				return l.Highlight
+			}
+		}
+		return -1
+	}
+	s.SetSpeaker("a", 100*time.Millisecond)
+	if level("a") != 1 || level("b") != 0 {
+		t.Fatalf("first speaker should be lit at once: a=%v b=%v", level("a"), level("b"))
+	}
+	s.Update(0)
+	s.SetSpeaker("b", 100*time.Millisecond)
+	s.Update(50 * time.Millisecond)
+	if level("a") != 0.5 || level("b") != 0.5 {
+		t.Fatalf("highlight should move halfway: a=%v b=%v", level("a"), level("b"))
+	}
+	s.SetSpeaker("narrator", 100*time.Millisecond)
+	s.Update(100 * time.Millisecond)
+	if level("a") != 1 || level("b") != 1 {
+		t.Fatalf("everyone is lit when no one on stage speaks: a=%v b=%v", level("a"), level("b"))
+	}
+}
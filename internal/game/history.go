@@ -0,0 +1,29 @@
+package game
+
+import "novegido/internal/script"
+
+// nvlPages returns, oldest first, the pages whose lines are on the NVL panel
+// after visiting history. The panel holds the run of consecutive NVL pages
+// ending at the current one, cut at the most recent page that clears it.
+func nvlPages(pages []*script.Page, history []int) []int {
+	if len(history) == 0 || pages[history[len(history)-1]].Mode != script.ModeNVL {
+		return nil
+	}
+	start := len(history) - 1
+	for start > 0 {
+		if pages[history[start]].Clear {
+			break
+		}
+		if pages[history[start-1]].Mode != script.ModeNVL {
+			break
+		}
+		start--
+	}
+	var out []int
+	for _, idx := range history[start:] {
+		if pages[idx].Dialogue != nil {
+			out = append(out, idx)
+		}
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"novegido/internal/script"
+)
+
+func nvlScript() []*script.Page {
+	d := &script.DialogueInfo{Text: "line"}
+	return []*script.Page{
+		{Mode: script.ModeADV, Dialogue: d},
+		{Mode: script.ModeNVL, Dialogue: d},
+		{Mode: script.ModeNVL, Dialogue: d},
+		{Mode: script.ModeNVL},
+		{Mode: script.ModeNVL, Dialogue: d, Clear: true},
+		{Mode: script.ModeNVL, Dialogue: d},
+		{Mode: script.ModeADV, Dialogue: d},
+	}
+}
+
+func TestNVLPages(t *testing.T) {
+	pages := nvlScript()
+	tests := []struct {
+		name    string
+		history []int
+		want    []int
+	}{
+		{"adv", []int{0}, nil},
+		{"first nvl", []int{0, 1}, []int{1}},
+		{"accumulate", []int{0, 1, 2, 3}, []int{1, 2}},
+		{"clear", []int{0, 1, 2, 3, 4, 5}, []int{4, 5}},
+		{"back to adv", []int{0, 1, 2, 3, 4, 5, 6}, nil},
+		{"rollback", []int{0, 1, 2}, []int{1, 2}},
+		{"jump resets panel", []int{6, 5}, []int{5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nvlPages(pages, tt.history)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nvlPages(%v) = %v, want %v", tt.history, got, tt.want)
+			}
+		})
+	}
+}
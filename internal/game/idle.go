@@ -0,0 +1,101 @@
+package game
+
+import (
+	"hash/fnv"
+	"maps"
+	"time"
+	"unicode/utf8"
+
+	"novegido/internal/character"
+	"novegido/internal/script"
+)
+
+// Idle animation defaults for characters that leave them out.
+const (
+	defaultAnimFrame   = 80 * time.Millisecond
+	defaultBlinkMin    = 2 * time.Second
+	defaultBlinkPeriod = 5 * time.Second
+	// talkPerRune is how long a line without a voice keeps the speaker's
+	// mouth moving, per character of text.
+	talkPerRune = 60 * time.Millisecond
+)
+
+func msOr(ms int, def time.Duration) time.Duration {
+	if ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return def
+}
+
+// blinkFrame returns the part shown by a blink at stage time clock for the
+// sprite id, or "" when the eyes are open. Time is cut into periods of
+// IntervalMs[1] with one blink in each, at an offset picked from the sprite
+// ID and period so that sprites blink independently but reproducibly.
+func blinkFrame(b *character.Blink, id string, clock time.Duration) string {
+	if b == nil || len(b.Frames) == 0 {
+		return ""
+	}
+	frame := msOr(b.FrameMs, defaultAnimFrame)
+	length := frame * time.Duration(len(b.Frames))
+	min := msOr(b.IntervalMs[0], defaultBlinkMin)
+	period := msOr(b.IntervalMs[1], defaultBlinkPeriod)
+	if period < min+length {
+		period = min + length
+	}
+	n := clock / period
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	h.Write([]byte{byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24)})
+	start := time.Duration(h.Sum64() % uint64(period-min))
+	t := clock - n*period - start
+	if t < 0 || t >= length {
+		return ""
+	}
+	return b.Frames[t/frame]
+}
+
+// talkFrame returns the part shown by a talk animation at stage time clock.
+func talkFrame(a *character.FrameAnim, clock time.Duration) string {
+	if a == nil || len(a.Frames) == 0 {
+		return ""
+	}
+	frame := msOr(a.FrameMs, defaultAnimFrame)
+	return a.Frames[int(clock/frame)%len(a.Frames)]
+}
+
+// animateSprite returns s with the blink and talk frames of its layered
+// character at clock chosen in its layers. Sprites of other characters are
+// returned unchanged.
+func animateSprite(cast *character.Registry, s script.SpriteInfo, clock time.Duration, talking bool) script.SpriteInfo {
+	c := cast.Get(spriteCharacter(s))
+	if c == nil || c.Layered == nil {
+		return s
+	}
+	l := c.Layered
+	blink := blinkFrame(l.Blink, s.ID, clock)
+	talk := ""
+	if talking {
+		talk = talkFrame(l.Talk, clock)
+	}
+	if blink == "" && talk == "" {
+		return s
+	}
+	layers := maps.Clone(s.Layers)
+	if layers == nil {
+		layers = map[string]string{}
+	}
+	if blink != "" {
+		layers[l.Blink.Slot] = blink
+	}
+	if talk != "" {
+		layers[l.Talk.Slot] = talk
+	}
+	s.Layers = layers
+	return s
+}
+
+// talkDuration is how long a line of text counts as being spoken when it
+// has no voice.
+func talkDuration(text string) time.Duration {
+	return time.Duration(utf8.RuneCountInString(text)) * talkPerRune
+}
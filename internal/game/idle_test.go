@@ -0,0 +1,85 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"testing"
+	"time"
+
+	"novegido/internal/character"
+	"novegido/internal/script"
+)
+
+func TestBlinkFrame(t *testing.T) {
+	b := &character.Blink{
+		FrameAnim:  character.FrameAnim{Slot: "eyes", Frames: []string{"half", "closed", "half"}, FrameMs: 50},
+		IntervalMs: [2]int{1000, 3000},
+	}
+	// Scan ten periods: each holds exactly one blink of three frames.
+	var blinks, closed int
+	prev := ""
+	for clock := time.Duration(0); clock < 30*time.Second; clock += 10 * time.Millisecond {
+		f := blinkFrame(b, "kuro", clock)
+		if f != "" && prev == "" {
+			blinks++
+		}
+		if f == "closed" {
+			closed++
+		}
+		prev = f
+	}
+	if blinks != 10 {
+		t.Errorf("blinks = %d, want 10", blinks)
+	}
+	if closed != 50 {
+		t.Errorf("closed ticks = %d, want 50 (5 per blink)", closed)
+	}
+	if blinkFrame(b, "kuro", 1234*time.Millisecond) != blinkFrame(b, "kuro", 1234*time.Millisecond) {
+		t.Errorf("blinks should be reproducible")
+	}
+	if blinkFrame(nil, "kuro", 0) != "" {
+		t.Errorf("no blink animation should keep eyes open")
+	}
+}
+
+func TestTalkFrame(t *testing.T) {
+	a := &character.FrameAnim{Slot: "mouth", Frames: []string{"open", "closed"}, FrameMs: 100}
+	for _, tt := range []struct {
+		clock time.Duration
+		want  string
+	}{{0, "open"}, {150 * time.Millisecond, "closed"}, {250 * time.Millisecond, "open"}} {
+		if got := talkFrame(a, tt.clock); got != tt.want {
+			t.Errorf("talkFrame(%v) = %q, want %q", tt.clock, got, tt.want)
+		}
+	}
+}
+
+func TestAnimateSprite(t *testing.T) {
+	cast := character.NewRegistry("ja", map[string]*character.Character{
+		"kuro": {Layered: &character.Layered{
+			Talk: &character.FrameAnim{Slot: "mouth", Frames: []string{"open"}},
+		}},
+	})
+	s := script.SpriteInfo{ID: "kuro", Layers: map[string]string{"outfit": "winter"}}
+	got := animateSprite(cast, s, 0, true)
+	if got.Layers["mouth"] != "open" || got.Layers["outfit"] != "winter" {
+		t.Errorf("talking layers = %v", got.Layers)
+	}
+	if _, ok := s.Layers["mouth"]; ok {
+		t.Errorf("animateSprite modified its input")
+	}
+	if got := animateSprite(cast, s, 0, false); got.Layers["mouth"] != "" {
+		t.Errorf("silent sprite should keep its mouth: %v", got.Layers)
+	}
+	plain := script.SpriteInfo{ID: "siro", Expr: "joy"}
+	if got := animateSprite(cast, plain, 0, true); got.Layers != nil {
+		t.Errorf("non-layered sprite should be unchanged: %+v", got)
+	}
+}
+
+func TestTalkDuration(t *testing.T) {
+	if got := talkDuration("おはよう"); got != 4*talkPerRune {
+		t.Errorf("talkDuration = %v", got)
+	}
+}
@@ -0,0 +1,122 @@
+package game
+
+import (
+	"maps"
+	"time"
+
+	"novegido/internal/anim"
+	"novegido/internal/script"
+)
+
+// MixerTrack is a looping track and its own volume, which is full when
+// unset.
+type MixerTrack struct {
+	File   string   `json:"file,omitempty"`
+	Volume *float64 `json:"volume,omitempty"`
+}
+
+// Gain returns the track's volume.
+func (t MixerTrack) Gain() float64 {
+	if t.Volume != nil {
+		return *t.Volume
+	}
+	return 1
+}
+
+// MixerState is the persistent part of the audio: the channel volumes and
+// the looping tracks that are playing. Like the stage state it is recorded
+// for each visited page and saved with the game. Sound effects and voices
+// are over too soon to be part of it.
+type MixerState struct {
+	Volumes map[string]float64 `json:"volumes,omitempty"`
+	BGM     MixerTrack         `json:"bgm"`
+	Ambient MixerTrack         `json:"ambient"`
+}
+
+// Volume returns the volume of channel, which is full unless set.
+func (m MixerState) Volume(channel string) float64 {
+	if v, ok := m.Volumes[channel]; ok {
+		return v
+	}
+	return 1
+}
+
+// applyAudio returns the mixer state after a page's audio changes state.
+// Stops come first, followed by volume changes and then new tracks.
+func applyAudio(m MixerState, a *script.AudioInfo) MixerState {
+	if a == nil {
+		return m
+	}
+	if a.Stops(script.ChannelBGM) {
+		m.BGM = MixerTrack{}
+	}
+	if a.Stops(script.ChannelAmbient) {
+		m.Ambient = MixerTrack{}
+	}
+	if len(a.Volume) > 0 {
+		vols := maps.Clone(m.Volumes)
+		if vols == nil {
+			vols = map[string]float64{}
+		}
+		maps.Copy(vols, a.Volume)
+		m.Volumes = vols
+	}
+	if a.File != "" && a.Loop {
+		m.BGM = MixerTrack{File: a.File}
+	}
+	if t := a.BGM; t != nil && t.File != "" {
+		m.BGM = MixerTrack{File: t.File, Volume: t.Volume}
+	}
+	if t := a.Ambient; t != nil && t.File != "" {
+		m.Ambient = MixerTrack{File: t.File, Volume: t.Volume}
+	}
+	return m
+}
+
+// soundEffects returns the one-shot sounds a page's audio plays.
+func soundEffects(a *script.AudioInfo) []script.TrackInfo {
+	if a == nil {
+		return nil
+	}
+	var out []script.TrackInfo
+	if a.File != "" && !a.Loop {
+		out = append(out, script.TrackInfo{File: a.File})
+	}
+	return append(out, a.SE...)
+}
+
+// ramp moves a volume level from one value to another over time.
+type ramp struct {
+	from, to float64
+	tween    anim.Tween
+}
+
+// newRamp starts a ramp from from to to lasting d.
+func newRamp(from, to float64, d time.Duration) ramp {
+	return ramp{from: from, to: to, tween: anim.NewTween(d, anim.Linear)}
+}
+
+// steady returns a ramp that stays at level.
+func steady(level float64) ramp { return ramp{from: level, to: level} }
+
+func (r *ramp) update(dt time.Duration) { r.tween.Update(dt) }
+
+// level returns the current level.
+func (r ramp) level() float64 { return anim.Lerp(r.from, r.to, r.tween.Value()) }
+
+// done reports whether the ramp has reached its end.
+func (r ramp) done() bool { return r.tween.Done() }
+
+// trackFades says how a looping track replaced by t gives way: the old track
+// fades out over out, the new one starts after delay and fades in over in.
+func trackFades(t *script.TrackInfo) (out, delay, in time.Duration) {
+	if t == nil {
+		return 0, 0, 0
+	}
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	if t.CrossfadeMs > 0 {
+		d := ms(t.CrossfadeMs)
+		return d, 0, d
+	}
+	return ms(t.FadeOutMs), ms(t.FadeOutMs), ms(t.FadeInMs)
+}
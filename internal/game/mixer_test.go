@@ -0,0 +1,104 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"novegido/internal/script"
+)
+
+func TestApplyAudio(t *testing.T) {
+	base := MixerState{BGM: MixerTrack{File: "town.mp3"}, Ambient: MixerTrack{File: "rain.mp3"}}
+	tests := []struct {
+		name string
+		a    *script.AudioInfo
+		want MixerState
+	}{
+		{"nil keeps", nil, base},
+		{"sound effect keeps", &script.AudioInfo{SE: []script.TrackInfo{{File: "door.mp3"}}}, base},
+		{"legacy loop is bgm", &script.AudioInfo{File: "battle.mp3", Loop: true},
+			MixerState{BGM: MixerTrack{File: "battle.mp3"}, Ambient: base.Ambient}},
+		{"legacy one-shot keeps", &script.AudioInfo{File: "door.mp3"}, base},
+		{"stop", &script.AudioInfo{Stop: []script.StopInfo{{Channel: "bgm"}, {Channel: "ambient"}}}, MixerState{}},
+		{"stop then play", &script.AudioInfo{Stop: []script.StopInfo{{Channel: "bgm"}}, BGM: &script.TrackInfo{File: "night.mp3", Volume: f64p(0.5)}},
+			MixerState{BGM: MixerTrack{File: "night.mp3", Volume: f64p(0.5)}, Ambient: base.Ambient}},
+		{"volume", &script.AudioInfo{Volume: map[string]float64{"se": 0.3}},
+			MixerState{Volumes: map[string]float64{"se": 0.3}, BGM: base.BGM, Ambient: base.Ambient}},
+	}
+	for _, tt := range tests {
+		if got := applyAudio(base, tt.a); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyAudioVolumesAreCopied(t *testing.T) {
+	base := MixerState{Volumes: map[string]float64{"bgm": 0.5}}
+	got := applyAudio(base, &script.AudioInfo{Volume: map[string]float64{"voice": 0}})
+	if got.Volume("bgm") != 0.5 || got.Volume("voice") != 0 || got.Volume("se") != 1 {
+		t.Fatalf("volumes = %v", got.Volumes)
+	}
+	if len(base.Volumes) != 1 {
+		t.Fatalf("applyAudio modified its input: %v", base.Volumes)
+	}
+}
+
+func TestMixerTrackGain(t *testing.T) {
+	if g := (MixerTrack{File: "town.mp3"}).Gain(); g != 1 {
+		t.Errorf("unset volume: %v, want 1", g)
+	}
+	if g := (MixerTrack{File: "town.mp3", Volume: f64p(0)}).Gain(); g != 0 {
+		t.Errorf("muted track: %v, want 0", g)
+	}
+}
+
+func TestSoundEffects(t *testing.T) {
+	a := &script.AudioInfo{File: "door.mp3", SE: []script.TrackInfo{{File: "bell.mp3", Volume: f64p(0.5)}}}
+	want := []script.TrackInfo{{File: "door.mp3"}, {File: "bell.mp3", Volume: f64p(0.5)}}
+	if got := soundEffects(a); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if got := soundEffects(&script.AudioInfo{File: "bgm.mp3", Loop: true}); len(got) != 0 {
+		t.Fatalf("a looping file is not a sound effect: %+v", got)
+	}
+}
+
+func TestRamp(t *testing.T) {
+	r := newRamp(1, 0, 200*time.Millisecond)
+	r.update(50 * time.Millisecond)
+	if got := r.level(); got != 0.75 {
+		t.Fatalf("level = %v, want 0.75", got)
+	}
+	r.update(150 * time.Millisecond)
+	if !r.done() || r.level() != 0 {
+		t.Fatalf("ramp should have ended at 0: %v", r.level())
+	}
+	if s := steady(1); !s.done() || s.level() != 1 {
+		t.Fatalf("steady ramp = %v", s.level())
+	}
+}
+
+func TestTrackFades(t *testing.T) {
+	tests := []struct {
+		name           string
+		info           *script.TrackInfo
+		out, delay, in time.Duration
+	}{
+		{"cut", nil, 0, 0, 0},
+		{"fade in", &script.TrackInfo{FadeInMs: 500}, 0, 0, 500 * time.Millisecond},
+		{"out then in", &script.TrackInfo{FadeOutMs: 300, FadeInMs: 500},
+			300 * time.Millisecond, 300 * time.Millisecond, 500 * time.Millisecond},
+		{"crossfade wins", &script.TrackInfo{FadeOutMs: 300, CrossfadeMs: 1000},
+			time.Second, 0, time.Second},
+	}
+	for _, tt := range tests {
+		out, delay, in := trackFades(tt.info)
+		if out != tt.out || delay != tt.delay || in != tt.in {
+			t.Errorf("%s: got %v, %v, %v, want %v, %v, %v", tt.name, out, delay, in, tt.out, tt.delay, tt.in)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package game
+
+import (
+	"math"
+
+	"novegido/internal/anim"
+	"novegido/internal/script"
+)
+
+// SpriteMotion is the animated displacement of a sprite on top of its
+// placement. MoveFrom, when set, is the placement the sprite glides away
+// from, MoveProgress of the way towards its own. SlideX and SlideY are
+// fractions of the screen size; OffsetX and OffsetY are pixels. Scale, when
+// non-zero, replaces the sprite's own scale.
+type SpriteMotion struct {
+	MoveFrom     *script.SpriteInfo
+	MoveProgress float64
+	SlideX       float64
+	SlideY       float64
+	OffsetX      float64
+	OffsetY      float64
+	Scale        float64
+}
+
+// ScreenMotion displaces the whole stage. Zoom is about the screen centre
+// and is 1 when not zooming.
+type ScreenMotion struct {
+	OffsetX float64
+	OffsetY float64
+	Zoom    float64
+}
+
+// motion is one running animation of a sprite or the screen. from holds the
+// sprite as it was before a move or zoom changed it.
+type motion struct {
+	info  script.MotionInfo
+	tween anim.Tween
+	from  script.SpriteInfo
+}
+
+func newMotion(m script.MotionInfo, from script.SpriteInfo) *motion {
+	return &motion{
+		info:  m,
+		tween: anim.NewTween(m.Duration(), anim.EasingByName(m.Easing)),
+		from:  from,
+	}
+}
+
+// count returns the number of hops or shakes, at least one.
+func (m *motion) count() float64 {
+	if m.info.Count > 0 {
+		return float64(m.info.Count)
+	}
+	return 1
+}
+
+// wave returns the shake displacement at linear progress p: Amount pixels
+// decaying to nothing by the end.
+func (m *motion) wave(p float64) float64 {
+	return m.info.Amount * math.Sin(2*math.Pi*m.count()*p) * (1 - p)
+}
+
+// applyMotion changes the persistent sprite info for motions that leave the
+// sprite somewhere else. It returns false when the motion has no effect on
+// sprites of this kind.
+func applyMotion(info *script.SpriteInfo, m script.MotionInfo) bool {
+	switch m.Type {
+	case script.MotionMove:
+		if m.To == "" && m.X == nil && m.Y == nil {
+			return false
+		}
+		info.Pos, info.X, info.Y = m.To, m.X, m.Y
+	case script.MotionZoom:
+		if m.Amount <= 0 {
+			return false
+		}
+		info.Scale = m.Amount
+	case script.MotionSlideIn, script.MotionHop, script.MotionShake:
+	default:
+		return false
+	}
+	return true
+}
+
+// spriteMotion composes the running motions of one sprite whose current
+// info is info.
+func spriteMotion(info script.SpriteInfo, motions []*motion) SpriteMotion {
+	var sm SpriteMotion
+	for _, m := range motions {
+		if m.tween.Done() {
+			continue
+		}
+		p, e := m.tween.Linear(), m.tween.Value()
+		switch m.info.Type {
+		case script.MotionMove:
+			from := m.from
+			sm.MoveFrom = &from
+			sm.MoveProgress = e
+		case script.MotionSlideIn:
+			d := 1 - e
+			switch m.info.From {
+			case "right":
+				sm.SlideX += d
+			case "top":
+				sm.SlideY -= d
+			case "bottom":
+				sm.SlideY += d
+			default:
+				sm.SlideX -= d
+			}
+		case script.MotionHop:
+			sm.OffsetY -= m.info.Amount * math.Abs(math.Sin(math.Pi*m.count()*e))
+		case script.MotionShake:
+			sm.OffsetX += m.wave(p)
+		case script.MotionZoom:
+			sm.Scale = anim.Lerp(scaleOr1(m.from.Scale), scaleOr1(info.Scale), e)
+		}
+	}
+	return sm
+}
+
+// screenMotion composes the running motions of the screen.
+func screenMotion(motions []*motion) ScreenMotion {
+	sm := ScreenMotion{Zoom: 1}
+	for _, m := range motions {
+		if m.tween.Done() {
+			continue
+		}
+		p, e := m.tween.Linear(), m.tween.Value()
+		switch m.info.Type {
+		case script.MotionShake:
+			sm.OffsetX += m.wave(p)
+			sm.OffsetY += m.wave(p+0.25/m.count()) / 2
+		case script.MotionZoom:
+			if m.info.Amount > 0 {
+				sm.Zoom *= anim.Lerp(1, m.info.Amount, math.Sin(math.Pi*e))
+			}
+		}
+	}
+	return sm
+}
+
+func scaleOr1(s float64) float64 {
+	if s <= 0 {
+		return 1
+	}
+	return s
+}
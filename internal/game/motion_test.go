@@ -0,0 +1,94 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"novegido/internal/script"
+)
+
+func TestMotionMoveUpdatesState(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{Sprites: []script.SpriteInfo{{ID: "a", File: "a.png", Pos: "left"}}})
+	s.Apply(&script.StageInfo{Motion: []script.MotionInfo{
+		{Target: "a", Type: script.MotionMove, To: "right", DurationMs: 100},
+	}})
+	if got := s.State().Sprites[0].Pos; got != "right" {
+		t.Fatalf("state Pos = %q, want right", got)
+	}
+	s.Update(50 * time.Millisecond)
+	mo := s.Snapshot().Sprites[0].Motion
+	if mo.MoveFrom == nil || mo.MoveFrom.Pos != "left" || mo.MoveProgress != 0.5 {
+		t.Fatalf("unexpected motion: %+v", mo)
+	}
+	if !s.Transitioning() {
+		t.Fatalf("motion should count as transitioning")
+	}
+	s.Update(50 * time.Millisecond)
+	if mo := s.Snapshot().Sprites[0].Motion; mo.MoveFrom != nil {
+		t.Fatalf("move should be finished: %+v", mo)
+	}
+	if s.Transitioning() {
+		t.Fatalf("stage should be idle")
+	}
+}
+
+func TestMotionSlideHopShake(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{
+		Sprites: []script.SpriteInfo{{ID: "a", File: "a.png"}},
+		Motion: []script.MotionInfo{
+			{Target: "a", Type: script.MotionSlideIn, From: "right", DurationMs: 100},
+			{Target: "a", Type: script.MotionHop, Amount: 20, DurationMs: 100},
+		},
+	})
+	mo := s.Snapshot().Sprites[0].Motion
+	if mo.SlideX != 1 || mo.OffsetY != 0 {
+		t.Fatalf("start of slide: %+v", mo)
+	}
+	s.Update(50 * time.Millisecond)
+	mo = s.Snapshot().Sprites[0].Motion
+	if mo.SlideX != 0.5 || math.Abs(mo.OffsetY+20) > 1e-9 {
+		t.Fatalf("middle of slide and hop: %+v", mo)
+	}
+
+	s.Apply(&script.StageInfo{Motion: []script.MotionInfo{
+		{Target: script.MotionTargetScreen, Type: script.MotionShake, Amount: 10, Count: 2, DurationMs: 100},
+		{Target: "missing", Type: script.MotionShake, Amount: 10, DurationMs: 100},
+	}})
+	s.Update(12500 * time.Microsecond)
+	if sm := s.Snapshot().Screen; sm.OffsetX == 0 || sm.Zoom != 1 {
+		t.Fatalf("screen should shake: %+v", sm)
+	}
+}
+
+func TestMotionZoomAndFinish(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{
+		Sprites: []script.SpriteInfo{{ID: "a", File: "a.png"}},
+		Motion: []script.MotionInfo{
+			{Target: "a", Type: script.MotionZoom, Amount: 2, DurationMs: 100},
+			{Target: script.MotionTargetScreen, Type: script.MotionZoom, Amount: 1.5, DurationMs: 100},
+		},
+	})
+	s.Update(50 * time.Millisecond)
+	snap := s.Snapshot()
+	if got := snap.Sprites[0].Motion.Scale; got != 1.5 {
+		t.Errorf("sprite zoom = %v, want 1.5", got)
+	}
+	if got := snap.Screen.Zoom; got != 1.5 {
+		t.Errorf("screen zoom = %v, want 1.5 at the peak", got)
+	}
+	s.FinishTransitions()
+	snap = s.Snapshot()
+	if snap.Sprites[0].Motion != (SpriteMotion{}) || snap.Screen != (ScreenMotion{Zoom: 1}) {
+		t.Fatalf("motions should be finished: %+v", snap)
+	}
+	if got := s.State().Sprites[0].Scale; got != 2 {
+		t.Fatalf("state Scale = %v, want 2", got)
+	}
+}
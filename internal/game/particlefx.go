@@ -0,0 +1,44 @@
+//go:build !headless
+// +build !headless
+
+package game
+
+import (
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// drawParticles draws particles centred on their positions. Textured
+// particles come from assets/particles; the rest are rectangles of their
+// shape.
+func (r *StageRenderer) drawParticles(dst *ebiten.Image, particles []Particle) {
+	for _, p := range particles {
+		if p.Alpha <= 0 {
+			continue
+		}
+		img := r.white
+		w, h := p.Shape[0], p.Shape[1]
+		op := &ebiten.DrawImageOptions{}
+		if p.Texture != "" {
+			si := r.load(r.particleCache, "particles", p.Texture)
+			img = si.Image
+			w, h = si.size()
+			op.GeoM.Scale(1/si.density, 1/si.density)
+		} else {
+			op.GeoM.Scale(w, h)
+		}
+		op.GeoM.Translate(-w/2, -h/2)
+		op.GeoM.Rotate(p.Angle)
+		op.GeoM.Scale(p.Scale, p.Scale)
+		op.GeoM.Translate(p.X, p.Y)
+		// Parsed colours are not premultiplied.
+		op.ColorScale.ScaleWithColor(color.NRGBA(p.Color))
+		op.ColorScale.ScaleAlpha(float32(p.Alpha))
+		if p.Add {
+			op.Blend = ebiten.BlendLighter
+		}
+		op.Filter = ebiten.FilterLinear
+		dst.DrawImage(img, op)
+	}
+}
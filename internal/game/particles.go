@@ -0,0 +1,354 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"image/color"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"slices"
+	"time"
+
+	"novegido/internal/character"
+	"novegido/internal/script"
+)
+
+// Emitter spawn areas.
+const (
+	// AreaTop spawns particles just above the screen, for things that fall.
+	AreaTop = "top"
+	// AreaScreen spawns particles anywhere on the screen, for things that
+	// drift.
+	AreaScreen = "screen"
+)
+
+// BlendAdd draws particles additively so that they glow.
+const BlendAdd = "add"
+
+// EmitterConfig describes one kind of particle, such as rain or snow. Ranges
+// are [min, max] and a value is picked from each when a particle spawns.
+// Rate is particles per second, at most Max alive at once. Velocities are in
+// pixels per second and Gravity and Wind accelerate particles down and to
+// the right. Sway swings particles sideways by that many pixels, Spin turns
+// them in radians per second and Align points them along their velocity
+// instead. Pulse makes particles flicker that many times a second and they
+// fade in and out over FadeMs. Texture names an image in assets/particles;
+// without one a particle is a Shape-sized rectangle of Color, 4 by 4 pixels
+// when no shape is given. Prewarm fills the screen at once instead of
+// letting the first particles arrive.
+type EmitterConfig struct {
+	Rate    float64    `json:"rate"`
+	Max     int        `json:"max,omitempty"`
+	Area    string     `json:"area,omitempty"`
+	Life    [2]float64 `json:"life"`
+	VX      [2]float64 `json:"vx"`
+	VY      [2]float64 `json:"vy"`
+	Gravity float64    `json:"gravity,omitempty"`
+	Wind    float64    `json:"wind,omitempty"`
+	Sway    float64    `json:"sway,omitempty"`
+	Scale   [2]float64 `json:"scale,omitempty"`
+	Spin    [2]float64 `json:"spin,omitempty"`
+	Align   bool       `json:"align,omitempty"`
+	Pulse   float64    `json:"pulse,omitempty"`
+	FadeMs  int        `json:"fadeMs,omitempty"`
+	Texture string     `json:"texture,omitempty"`
+	Shape   [2]float64 `json:"shape,omitempty"`
+	Color   string     `json:"color,omitempty"`
+	Blend   string     `json:"blend,omitempty"`
+	Prewarm bool       `json:"prewarm,omitempty"`
+}
+
+// LoadEmitters reads a particle file mapping emitter names to their
+// settings. A missing file yields no emitters without an error.
+func LoadEmitters(path string) (map[string]EmitterConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]EmitterConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]EmitterConfig
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// applyParticles returns the running emitters after info starts and stops
+// some, in the order they were started.
+func applyParticles(names []string, info *script.ParticlesInfo) []string {
+	if info == nil {
+		return names
+	}
+	var out []string
+	if !info.Clear {
+		for _, n := range names {
+			if !slices.Contains(info.Stop, n) {
+				out = append(out, n)
+			}
+		}
+	}
+	for _, n := range info.Start {
+		if !slices.Contains(out, n) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// Particle is one particle to draw. X and Y are its centre on the stage.
+type Particle struct {
+	Texture string
+	Shape   [2]float64
+	Color   color.RGBA
+	Add     bool
+	X, Y    float64
+	Scale   float64
+	Angle   float64
+	Alpha   float64
+}
+
+type particle struct {
+	x, y   float64
+	vx, vy float64
+	age    float64
+	life   float64
+	scale  float64
+	angle  float64
+	spin   float64
+	phase  float64
+}
+
+// emitter runs one EmitterConfig. A stopped emitter spawns nothing more and
+// is dropped once its particles are gone.
+type emitter struct {
+	name    string
+	cfg     EmitterConfig
+	color   color.RGBA
+	rng     *rand.Rand
+	parts   []particle
+	due     float64
+	stopped bool
+}
+
+// swayPeriod is how long, in seconds, a particle takes to sway back and
+// forth.
+const swayPeriod = 2.0
+
+// defaultShape is the size of an untextured particle with no shape.
+var defaultShape = [2]float64{4, 4}
+
+// prewarmStep is the time step used to fill the screen for Prewarm, and
+// maxPrewarm caps how many seconds are simulated, long enough for slow snow
+// to cross the screen without long-lived particles stalling the page.
+const (
+	prewarmStep = 1.0 / 30
+	maxPrewarm  = 10.0
+)
+
+// ParticleField simulates the particles of every running emitter over a
+// w by h stage. Each emitter is seeded from its name so that the same
+// weather always falls the same way.
+type ParticleField struct {
+	configs  map[string]EmitterConfig
+	emitters []*emitter
+	w, h     float64
+}
+
+// NewParticleField returns a field that runs emitters from configs.
+func NewParticleField(configs map[string]EmitterConfig, w, h int) *ParticleField {
+	return &ParticleField{configs: configs, w: float64(w), h: float64(h)}
+}
+
+// SetBounds changes the size of the stage particles fall over.
+func (f *ParticleField) SetBounds(w, h int) {
+	f.w, f.h = float64(w), float64(h)
+}
+
+// Set makes names the running emitters. New emitters start and emitters
+// left out stop, letting their particles live out their lifetimes. Unknown
+// names are logged and ignored.
+func (f *ParticleField) Set(names []string) {
+	for _, e := range f.emitters {
+		e.stopped = !slices.Contains(names, e.name)
+	}
+	for _, n := range names {
+		if slices.ContainsFunc(f.emitters, func(e *emitter) bool { return e.name == n }) {
+			continue
+		}
+		cfg, ok := f.configs[n]
+		if !ok {
+			log.Printf("unknown particle emitter %q", n)
+			continue
+		}
+		f.emitters = append(f.emitters, f.newEmitter(n, cfg))
+	}
+}
+
+func (f *ParticleField) newEmitter(name string, cfg EmitterConfig) *emitter {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	e := &emitter{name: name, cfg: cfg, color: color.RGBA{255, 255, 255, 255}, rng: rand.New(rand.NewSource(int64(h.Sum64())))}
+	if cfg.Texture == "" && cfg.Shape == ([2]float64{}) {
+		e.cfg.Shape = defaultShape
+	}
+	if cfg.Color != "" {
+		c, err := character.ParseColor(cfg.Color)
+		if err != nil {
+			log.Printf("particle emitter %q: %v", name, err)
+		} else {
+			e.color = c
+		}
+	}
+	if cfg.Prewarm {
+		for t := 0.0; t < math.Min(cfg.Life[1], maxPrewarm); t += prewarmStep {
+			e.update(prewarmStep, f.w, f.h)
+		}
+	}
+	return e
+}
+
+// Update advances every particle by dt.
+func (f *ParticleField) Update(dt time.Duration) {
+	sec := dt.Seconds()
+	emitters := f.emitters[:0]
+	for _, e := range f.emitters {
+		e.update(sec, f.w, f.h)
+		if !e.stopped || len(e.parts) > 0 {
+			emitters = append(emitters, e)
+		}
+	}
+	f.emitters = emitters
+}
+
+// Particles returns every live particle for drawing, emitters in the order
+// they were started.
+func (f *ParticleField) Particles() []Particle {
+	var out []Particle
+	for _, e := range f.emitters {
+		for _, p := range e.parts {
+			out = append(out, e.particle(p))
+		}
+	}
+	return out
+}
+
+// between picks a value from the range r.
+func between(rng *rand.Rand, r [2]float64) float64 {
+	if r[1] <= r[0] {
+		return r[0]
+	}
+	return r[0] + rng.Float64()*(r[1]-r[0])
+}
+
+// margin is how far outside the stage particles spawn and how far below it
+// they fall before being dropped, so that none pop in or out at the edges.
+func (e *emitter) margin() float64 {
+	return math.Max(e.cfg.Shape[0], e.cfg.Shape[1])*math.Max(1, e.cfg.Scale[1]) + e.cfg.Sway + 16
+}
+
+func (e *emitter) spawn(w, h float64) particle {
+	c := e.cfg
+	p := particle{
+		vx:    between(e.rng, c.VX),
+		vy:    between(e.rng, c.VY),
+		life:  between(e.rng, c.Life),
+		scale: between(e.rng, c.Scale),
+		spin:  between(e.rng, c.Spin),
+		phase: e.rng.Float64() * 2 * math.Pi,
+	}
+	if p.scale == 0 {
+		p.scale = 1
+	}
+	p.angle = e.rng.Float64() * 2 * math.Pi
+	if c.Spin == ([2]float64{}) {
+		p.angle = 0
+	}
+	if c.Area == AreaScreen {
+		p.x = e.rng.Float64() * w
+		p.y = e.rng.Float64() * h
+		return p
+	}
+	// Falling particles start across a band wide enough that wind blowing
+	// them sideways still covers the whole screen.
+	m := e.margin()
+	drift := (c.VX[0] + c.VX[1]) / 2 * p.life
+	lo, hi := math.Min(-m, -m-drift), math.Max(w+m, w+m-drift)
+	p.x = lo + e.rng.Float64()*(hi-lo)
+	p.y = -m
+	return p
+}
+
+func (e *emitter) update(dt, w, h float64) {
+	c := e.cfg
+	m := e.margin()
+	parts := e.parts[:0]
+	for _, p := range e.parts {
+		p.age += dt
+		p.vx += c.Wind * dt
+		p.vy += c.Gravity * dt
+		p.x += p.vx * dt
+		p.y += p.vy * dt
+		p.angle += p.spin * dt
+		if p.age >= p.life || p.y > h+m {
+			continue
+		}
+		parts = append(parts, p)
+	}
+	e.parts = parts
+	if e.stopped {
+		return
+	}
+	e.due += c.Rate * dt
+	for e.due >= 1 {
+		if c.Max > 0 && len(e.parts) >= c.Max {
+			// Spawns owed while full are dropped rather than counted down
+			// one by one or let out in a burst once there is room.
+			e.due -= math.Floor(e.due)
+			break
+		}
+		e.due--
+		e.parts = append(e.parts, e.spawn(w, h))
+	}
+}
+
+// particle resolves p to what is drawn.
+func (e *emitter) particle(p particle) Particle {
+	c := e.cfg
+	out := Particle{
+		Texture: c.Texture,
+		Shape:   c.Shape,
+		Color:   e.color,
+		Add:     c.Blend == BlendAdd,
+		X:       p.x,
+		Y:       p.y,
+		Scale:   p.scale,
+		Angle:   p.angle,
+		Alpha:   particleAlpha(p, c),
+	}
+	if c.Sway != 0 {
+		out.X += c.Sway * math.Sin(p.phase+p.age*2*math.Pi/swayPeriod)
+	}
+	if c.Align {
+		out.Angle = math.Atan2(p.vy, p.vx) - math.Pi/2
+	}
+	return out
+}
+
+// particleAlpha fades p in and out over the emitter's fade and applies its
+// flicker.
+func particleAlpha(p particle, c EmitterConfig) float64 {
+	a := 1.0
+	if c.FadeMs > 0 {
+		fade := float64(c.FadeMs) / 1000
+		a = math.Min(a, math.Min(p.age/fade, (p.life-p.age)/fade))
+	}
+	if c.Pulse > 0 {
+		a *= 0.5 + 0.5*math.Sin(p.phase+p.age*2*math.Pi*c.Pulse)
+	}
+	return math.Max(0, math.Min(1, a))
+}
@@ -0,0 +1,159 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"novegido/internal/script"
+)
+
+func TestApplyParticles(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		info *script.ParticlesInfo
+		want []string
+	}{
+		{"nil keeps", []string{"rain"}, nil, []string{"rain"}},
+		{"start", []string{"rain"}, &script.ParticlesInfo{Start: []string{"dust", "rain"}}, []string{"rain", "dust"}},
+		{"stop", []string{"rain", "dust"}, &script.ParticlesInfo{Stop: []string{"rain"}}, []string{"dust"}},
+		{"clear then start", []string{"rain"}, &script.ParticlesInfo{Clear: true, Start: []string{"snow"}}, []string{"snow"}},
+	}
+	for _, tt := range tests {
+		if got := applyParticles(tt.in, tt.info); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStageKeepsParticles(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{Particles: &script.ParticlesInfo{Start: []string{"snow"}}})
+	s.Apply(&script.StageInfo{BG: "a.png"})
+	state := s.State()
+	if !reflect.DeepEqual(state.Particles, []string{"snow"}) {
+		t.Fatalf("Particles = %v", state.Particles)
+	}
+	s.Restore(StageState{})
+	s.Restore(state)
+	if got := s.State().Particles; !reflect.DeepEqual(got, []string{"snow"}) {
+		t.Fatalf("restored Particles = %v", got)
+	}
+}
+
+var testEmitters = map[string]EmitterConfig{
+	"rain": {Rate: 100, Life: [2]float64{1, 1}, VY: [2]float64{500, 600}, Shape: [2]float64{1, 10}},
+	"dust": {Rate: 10, Max: 5, Area: AreaScreen, Life: [2]float64{10, 10}},
+}
+
+func TestParticleFieldSpawnsAndStops(t *testing.T) {
+	f := NewParticleField(testEmitters, 640, 480)
+	f.Set([]string{"rain", "dust", "unknown"})
+	f.Update(500 * time.Millisecond)
+	n := len(f.Particles())
+	if n != 55 {
+		t.Fatalf("got %d particles after half a second, want 50 rain and 5 dust", n)
+	}
+	for _, p := range f.Particles() {
+		if p.Shape == ([2]float64{}) {
+			t.Fatalf("untextured particle without a shape: %+v", p)
+		}
+	}
+
+	f.Set([]string{"dust"})
+	f.Update(time.Second)
+	for _, p := range f.Particles() {
+		if p.Shape == testEmitters["rain"].Shape {
+			t.Fatalf("rain should have stopped and fallen out: %+v", p)
+		}
+	}
+	if len(f.emitters) != 1 {
+		t.Fatalf("stopped emitter should be dropped once empty, have %d", len(f.emitters))
+	}
+}
+
+func TestParticleFieldIsDeterministic(t *testing.T) {
+	run := func() []Particle {
+		f := NewParticleField(testEmitters, 640, 480)
+		f.Set([]string{"rain"})
+		for i := 0; i < 10; i++ {
+			f.Update(16 * time.Millisecond)
+		}
+		return f.Particles()
+	}
+	if a, b := run(), run(); !reflect.DeepEqual(a, b) {
+		t.Fatal("the same emitter should produce the same particles")
+	}
+}
+
+func TestParticlePrewarm(t *testing.T) {
+	cfg := testEmitters["rain"]
+	cfg.Prewarm = true
+	f := NewParticleField(map[string]EmitterConfig{"rain": cfg}, 640, 480)
+	f.Set([]string{"rain"})
+	if len(f.Particles()) == 0 {
+		t.Fatal("prewarmed emitter should start with particles")
+	}
+}
+
+func TestParticlePrewarmIsCapped(t *testing.T) {
+	cfg := testEmitters["dust"]
+	cfg.Life = [2]float64{1e9, 1e9}
+	cfg.Prewarm = true
+	f := NewParticleField(map[string]EmitterConfig{"dust": cfg}, 640, 480)
+	f.Set([]string{"dust"})
+	if n := len(f.Particles()); n != cfg.Max {
+		t.Fatalf("got %d particles, want %d", n, cfg.Max)
+	}
+}
+
+func TestParticleMaxDropsOwedSpawns(t *testing.T) {
+	cfg := testEmitters["dust"]
+	cfg.Rate = 1e12
+	f := NewParticleField(map[string]EmitterConfig{"dust": cfg}, 640, 480)
+	f.Set([]string{"dust"})
+	f.Update(time.Second)
+	if n := len(f.Particles()); n != cfg.Max {
+		t.Fatalf("got %d particles, want %d", n, cfg.Max)
+	}
+	if due := f.emitters[0].due; due >= 1 {
+		t.Fatalf("due = %v while full, want less than 1", due)
+	}
+}
+
+func TestParticleAlpha(t *testing.T) {
+	c := EmitterConfig{FadeMs: 1000}
+	if got := particleAlpha(particle{age: 0.5, life: 10}, c); got != 0.5 {
+		t.Errorf("fading in: %v, want 0.5", got)
+	}
+	if got := particleAlpha(particle{age: 5, life: 10}, c); got != 1 {
+		t.Errorf("middle of life: %v, want 1", got)
+	}
+	if got := particleAlpha(particle{age: 9.75, life: 10}, c); got != 0.25 {
+		t.Errorf("fading out: %v, want 0.25", got)
+	}
+}
+
+func TestLoadEmitters(t *testing.T) {
+	m, err := LoadEmitters(filepath.Join(t.TempDir(), "none.json"))
+	if err != nil || len(m) != 0 {
+		t.Fatalf("missing file: %v, %v", m, err)
+	}
+	path := filepath.Join(t.TempDir(), "particles.json")
+	if err := os.WriteFile(path, []byte(`{"snow":{"rate":5,"life":[1,2],"blend":"add"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err = LoadEmitters(path)
+	if err != nil {
+		t.Fatalf("LoadEmitters error: %v", err)
+	}
+	if c := m["snow"]; c.Rate != 5 || c.Life != [2]float64{1, 2} || c.Blend != BlendAdd {
+		t.Fatalf("snow = %+v", c)
+	}
+}
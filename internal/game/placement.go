@@ -0,0 +1,99 @@
+package game
+
+import (
+	"math"
+	"sort"
+
+	"novegido/internal/project"
+	"novegido/internal/script"
+)
+
+// defaultPosition is used for sprites without a known preset: bottom centre.
+var defaultPosition = project.Position{
+	X:      script.Pct(50),
+	Y:      script.Pct(100),
+	Anchor: [2]float64{0.5, 1},
+}
+
+// spritePlacement is where and how a sprite image is drawn. X and Y are the
+// top-left corner of the scaled image.
+type spritePlacement struct {
+	X, Y  float64
+	Scale float64
+	Flip  bool
+	Alpha float64
+}
+
+// placeSprite works out the placement of an image of size imgW×imgH for s
+// on a screen of screenW×screenH. The preset named by s.Pos supplies the
+// defaults that X, Y and Anchor override.
+func placeSprite(s script.SpriteInfo, presets map[string]project.Position, screenW, screenH, imgW, imgH float64) spritePlacement {
+	pos, ok := presets[s.Pos]
+	if !ok {
+		if pos, ok = presets["center"]; !ok {
+			pos = defaultPosition
+		}
+	}
+	x, y, anchor := pos.X, pos.Y, pos.Anchor
+	if s.X != nil {
+		x = *s.X
+	}
+	if s.Y != nil {
+		y = *s.Y
+	}
+	if s.Anchor != nil {
+		anchor = *s.Anchor
+	}
+	scale := s.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	alpha := 1.0
+	if s.Opacity != nil {
+		alpha = *s.Opacity
+	}
+	return spritePlacement{
+		X:     x.Resolve(screenW) - anchor[0]*imgW*scale,
+		Y:     y.Resolve(screenH) - anchor[1]*imgH*scale,
+		Scale: scale,
+		Flip:  s.Flip,
+		Alpha: alpha,
+	}
+}
+
+// sortByZ orders sprite layers back to front, keeping the stage order for
+// sprites with the same Z.
+func sortByZ(layers []SpriteLayer) {
+	sort.SliceStable(layers, func(i, j int) bool { return layers[i].Info.Z < layers[j].Info.Z })
+}
+
+// bgPlacement is where a background image is drawn: scaled by SX and SY
+// with its top-left corner at (X, Y). Covers is false when part of the
+// screen is left for the letterbox colour.
+type bgPlacement struct {
+	SX, SY float64
+	X, Y   float64
+	Covers bool
+}
+
+// fitBackground places an image of size imgW×imgH on a screen of
+// screenW×screenH with one of the project fit modes or fitCamera. Unknown
+// modes stretch.
+func fitBackground(mode string, screenW, screenH, imgW, imgH float64) bgPlacement {
+	var s float64
+	switch mode {
+	case project.FitCover:
+		s = math.Max(screenW/imgW, screenH/imgH)
+	case project.FitContain:
+		s = math.Min(screenW/imgW, screenH/imgH)
+	case project.FitCenter:
+		s = 1
+	case fitCamera:
+		s = math.Max(1, math.Max(screenW/imgW, screenH/imgH))
+	default:
+		return bgPlacement{SX: screenW / imgW, SY: screenH / imgH, Covers: true}
+	}
+	w, h := imgW*s, imgH*s
+	x, y := (screenW-w)/2, (screenH-h)/2
+	return bgPlacement{SX: s, SY: s, X: x, Y: y, Covers: x <= 0 && y <= 0}
+}
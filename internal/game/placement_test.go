@@ -0,0 +1,78 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"testing"
+
+	"novegido/internal/project"
+	"novegido/internal/script"
+)
+
+func TestPlaceSprite(t *testing.T) {
+	presets := project.Default().Positions
+	px := func(v float64) *script.Coord { c := script.Px(v); return &c }
+	half := 0.5
+	tests := []struct {
+		name string
+		s    script.SpriteInfo
+		want spritePlacement
+	}{
+		{"preset", script.SpriteInfo{Pos: "left"}, spritePlacement{X: 110, Y: 200, Scale: 1, Alpha: 1}},
+		{"unknown preset", script.SpriteInfo{Pos: "nowhere"}, spritePlacement{X: 350, Y: 200, Scale: 1, Alpha: 1}},
+		{"explicit", script.SpriteInfo{X: px(10), Y: px(20), Anchor: &[2]float64{0, 0}},
+			spritePlacement{X: 10, Y: 20, Scale: 1, Alpha: 1}},
+		{"override x only", script.SpriteInfo{Pos: "right", X: px(500)}, spritePlacement{X: 450, Y: 200, Scale: 1, Alpha: 1}},
+		{"scale", script.SpriteInfo{Pos: "center", Scale: 2}, spritePlacement{X: 300, Y: 0, Scale: 2, Alpha: 1}},
+		{"flip and opacity", script.SpriteInfo{Pos: "center", Flip: true, Opacity: &half},
+			spritePlacement{X: 350, Y: 200, Scale: 1, Flip: true, Alpha: 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := placeSprite(tt.s, presets, 800, 400, 100, 200)
+			if got != tt.want {
+				t.Errorf("placeSprite = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotSortsByZ(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{Show: []script.SpriteInfo{
+		{ID: "front", Z: 5},
+		{ID: "a"},
+		{ID: "back", Z: -1},
+		{ID: "b"},
+	}})
+	var got []string
+	for _, l := range s.Snapshot().Sprites {
+		got = append(got, l.Info.ID)
+	}
+	want := []string{"back", "a", "b", "front"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("order = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFitBackground(t *testing.T) {
+	tests := []struct {
+		mode string
+		want bgPlacement
+	}{
+		{project.FitStretch, bgPlacement{SX: 2, SY: 0.5, Covers: true}},
+		{"", bgPlacement{SX: 2, SY: 0.5, Covers: true}},
+		{project.FitCover, bgPlacement{SX: 2, SY: 2, X: 0, Y: -300, Covers: true}},
+		{project.FitContain, bgPlacement{SX: 0.5, SY: 0.5, X: 75, Y: 0}},
+		{project.FitCenter, bgPlacement{SX: 1, SY: 1, X: 50, Y: -100}},
+	}
+	for _, tt := range tests {
+		// A tall 100×400 image on a 200×200 screen.
+		if got := fitBackground(tt.mode, 200, 200, 100, 400); got != tt.want {
+			t.Errorf("fitBackground(%q) = %+v, want %+v", tt.mode, got, tt.want)
+		}
+	}
+}
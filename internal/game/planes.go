@@ -0,0 +1,84 @@
+package game
+
+import (
+	"time"
+
+	"novegido/internal/anim"
+	"novegido/internal/script"
+)
+
+// Full-screen layers, named after the directory under assets that their
+// images are read from.
+const (
+	planeForeground = "foreground"
+	planeCG         = "cg"
+	planeOverlay    = "overlay"
+)
+
+// applyLayer returns the image a layer shows after info changes it.
+func applyLayer(file string, info *script.LayerInfo) string {
+	switch {
+	case info == nil:
+		return file
+	case info.Hide:
+		return ""
+	case info.File != "":
+		return info.File
+	}
+	return file
+}
+
+// plane is a full-screen layer. Like the background, a change of image gives
+// way from prev to file over fade. start and prevStart are the stage times
+// the images appeared.
+type plane struct {
+	file      string
+	prev      string
+	fade      anim.Tween
+	trans     script.TransitionInfo
+	start     time.Duration
+	prevStart time.Duration
+}
+
+// change starts the change to file that info asked for at stage time clock.
+func (p *plane) change(file string, info *script.LayerInfo, clock time.Duration) {
+	if info == nil || file == p.file {
+		return
+	}
+	p.prev = p.file
+	p.file = file
+	p.prevStart = p.start
+	p.start = clock
+	p.fade = anim.NewTween(info.Duration(), anim.EasingByName(info.Easing))
+	p.trans = script.TransitionInfo{}
+	if info.Transition != nil {
+		p.trans = *info.Transition
+	}
+}
+
+// PlaneLayer is a full-screen layer as drawn. While Progress, already eased,
+// is below 1 Prev gives way to File through Transition; an empty file is
+// nothing. Start and PrevStart are the stage times File and Prev appeared,
+// which their animations play from.
+type PlaneLayer struct {
+	File       string
+	Prev       string
+	Progress   float64
+	Transition script.TransitionInfo
+	Start      time.Duration
+	PrevStart  time.Duration
+}
+
+// Shown reports whether the layer shows an image with no change under way.
+func (l PlaneLayer) Shown() bool { return l.File != "" && l.Progress >= 1 }
+
+func (p *plane) snapshot() PlaneLayer {
+	l := PlaneLayer{File: p.file, Progress: 1, Start: p.start}
+	if !p.fade.Done() {
+		l.Prev = p.prev
+		l.PrevStart = p.prevStart
+		l.Progress = p.fade.Value()
+		l.Transition = p.trans
+	}
+	return l
+}
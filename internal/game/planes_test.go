@@ -0,0 +1,72 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"testing"
+	"time"
+
+	"novegido/internal/script"
+)
+
+func TestApplyLayer(t *testing.T) {
+	tests := []struct {
+		name string
+		info *script.LayerInfo
+		want string
+	}{
+		{"nil keeps", nil, "a.png"},
+		{"file replaces", &script.LayerInfo{File: "b.png"}, "b.png"},
+		{"hide", &script.LayerInfo{Hide: true, FadeMs: 100}, ""},
+		{"fade only keeps", &script.LayerInfo{FadeMs: 100}, "a.png"},
+	}
+	for _, tt := range tests {
+		if got := applyLayer("a.png", tt.info); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStageLayers(t *testing.T) {
+	s := NewStage()
+	wipe := &script.TransitionInfo{Type: "wipe", Direction: "right"}
+	s.Apply(&script.StageInfo{
+		BG:         "room.jpg",
+		Foreground: &script.LayerInfo{File: "desk.png"},
+		CG:         &script.LayerInfo{File: "ev01.png", FadeMs: 100, Transition: wipe},
+	})
+	snap := s.Snapshot()
+	if !snap.Foreground.Shown() || snap.Foreground.File != "desk.png" {
+		t.Fatalf("foreground without a fade should be shown at once: %+v", snap.Foreground)
+	}
+	if snap.CG.Shown() || snap.CG.Transition != *wipe || !s.Transitioning() {
+		t.Fatalf("CG should be wiping in: %+v", snap.CG)
+	}
+	s.Update(50 * time.Millisecond)
+	if got := s.Snapshot().CG; got.Progress != 0.5 || got.Prev != "" {
+		t.Fatalf("CG halfway = %+v", got)
+	}
+	s.Update(50 * time.Millisecond)
+	if !s.Snapshot().CG.Shown() {
+		t.Fatal("CG should be shown")
+	}
+
+	s.Apply(&script.StageInfo{CG: &script.LayerInfo{Hide: true, FadeMs: 100}, Overlay: &script.LayerInfo{File: "bars.png"}})
+	state := s.State()
+	if state.CG != "" || state.Foreground != "desk.png" || state.Overlay != "bars.png" {
+		t.Fatalf("state = %+v", state)
+	}
+	if got := s.Snapshot().CG; got.Prev != "ev01.png" || got.File != "" {
+		t.Fatalf("hidden CG should fade out: %+v", got)
+	}
+	s.FinishTransitions()
+	if s.Transitioning() {
+		t.Fatal("layer changes should finish")
+	}
+
+	s.Restore(StageState{CG: "ev02.png"})
+	if got := s.Snapshot(); !got.CG.Shown() || got.Foreground.File != "" {
+		t.Fatalf("restore should be instant: %+v", got)
+	}
+}
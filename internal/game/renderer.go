@@ -6,192 +6,447 @@ package game
 import (
 	"image/color"
 	"log"
+	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/colorm"
 
+	"novegido/internal/anim"
+	"novegido/internal/animimg"
+	"novegido/internal/character"
+	"novegido/internal/project"
 	"novegido/internal/script"
 )
 
-// StageRenderer handles rendering of backgrounds and sprites with simple fades.
-type StageRenderer struct {
-	bgCache     map[string]*ebiten.Image
-	spriteCache map[string]*ebiten.Image
+// stageImage is a loaded image and the pixel density of the variant that
+// was found; a 2x image is drawn at half its pixel size. Animated images
+// also hold their frames, the first of which is Image.
+type stageImage struct {
+	*ebiten.Image
+	density float64
+	frames  []*ebiten.Image
+	anim    animimg.Animation
+}
+
+// at returns the frame showing t into the animation.
+func (i stageImage) at(t time.Duration) *ebiten.Image {
+	if len(i.frames) <= 1 {
+		return i.Image
+	}
+	return i.frames[i.anim.FrameAt(t)]
+}
 
-	currBG        string
-	prevBG        string
-	bgFadeFrames  int
-	bgFadeCounter int
+// size returns the size of the image in stage pixels.
+func (i stageImage) size() (w, h float64) {
+	return float64(i.Bounds().Dx()) / i.density, float64(i.Bounds().Dy()) / i.density
+}
 
-	currSprites       []script.SpriteInfo
-	prevSprites       []script.SpriteInfo
-	spriteFadeFrames  int
-	spriteFadeCounter int
+// StageRenderer draws a StageSnapshot. It owns the image caches but holds no
+// stage state of its own, so drawing more or fewer frames has no effect on
+// the game.
+type StageRenderer struct {
+	bgCache     map[string]stageImage
+	spriteCache map[string]stageImage
+	// partCache holds the parts of layered sprites, whose compositions are
+	// kept in spriteCache.
+	partCache     map[string]stageImage
+	portraitCache map[string]stageImage
+	particleCache map[string]stageImage
+	// planeCache holds the images of each full-screen layer by layer name.
+	planeCache map[string]map[string]stageImage
+	// density is the asset density chosen for the current render scale.
+	density float64
+	// clock is the stage time of the snapshot being drawn. Animated images
+	// play from the stage time they appeared at.
+	clock time.Duration
 
+	cast  *character.Registry
+	cfg   *project.Config
 	black *ebiten.Image
+	// view maps stage coordinates to the screen for the camera and screen
+	// motion while the stage is drawn, and cameraBG lays backgrounds out for
+	// the camera while it is in use; layer is working space for blur and
+	// for layer transitions.
+	view     ebiten.GeoM
+	cameraBG bool
+	layer    *ebiten.Image
+	// post holds the stage while screen effects are applied; white and
+	// vignette are drawn scaled and tinted over it.
+	post     *ebiten.Image
+	white    *ebiten.Image
+	vignette *ebiten.Image
+	// scratch, mask and maskPix are working space for transitions; orders
+	// caches reveal orders by wipe, iris or rule name.
+	scratch *ebiten.Image
+	mask    *ebiten.Image
+	maskPix []byte
+	orders  map[string][]float64
 
 	screenW, screenH int
 }
 
 // NewStageRenderer creates a renderer for a stage of the given screen size.
-func NewStageRenderer(w, h int) *StageRenderer {
+// Character references in sprites are resolved through cast, and position
+// presets and background fits come from cfg.
+func NewStageRenderer(w, h int, cast *character.Registry, cfg *project.Config) *StageRenderer {
 	black := ebiten.NewImage(w, h)
 	black.Fill(color.Black)
+	white := ebiten.NewImage(1, 1)
+	white.Fill(color.White)
 	return &StageRenderer{
-		bgCache:     map[string]*ebiten.Image{},
-		spriteCache: map[string]*ebiten.Image{},
-		black:       black,
-		screenW:     w,
-		screenH:     h,
+		bgCache:       map[string]stageImage{},
+		spriteCache:   map[string]stageImage{},
+		partCache:     map[string]stageImage{},
+		portraitCache: map[string]stageImage{},
+		particleCache: map[string]stageImage{},
+		planeCache:    map[string]map[string]stageImage{},
+		density:       1,
+		cast:          cast,
+		cfg:           cfg,
+		black:         black,
+		layer:         ebiten.NewImage(w, h),
+		post:          ebiten.NewImage(w, h),
+		white:         white,
+		vignette:      newVignette(w, h),
+		scratch:       ebiten.NewImage(w, h),
+		mask:          ebiten.NewImage(w, h),
+		maskPix:       make([]byte, 4*w*h),
+		orders:        map[string][]float64{},
+		screenW:       w,
+		screenH:       h,
 	}
 }
 
-func (r *StageRenderer) load(cache map[string]*ebiten.Image, dir, file string) *ebiten.Image {
+// portrait returns a side portrait image from assets/portraits.
+func (r *StageRenderer) portrait(file string) *ebiten.Image {
+	return r.load(r.portraitCache, "portraits", file).Image
+}
+
+// load returns an image from assets/dir, preferring the @2x or @1x variant
+// that suits the render scale.
+func (r *StageRenderer) load(cache map[string]stageImage, dir, file string) stageImage {
 	if img, ok := cache[file]; ok {
 		return img
 	}
-	full := filepath.Join("assets", dir, file)
-	img, _, err := ebitenutil.NewImageFromFile(full)
+	vs := assetVariants(file, r.density)
+	v := vs[0]
+	for _, c := range vs {
+		if _, err := os.Stat(filepath.Join("assets", dir, c.File)); err == nil {
+			v = c
+			break
+		}
+	}
+	si, err := loadImage(filepath.Join("assets", dir, v.File))
 	if err != nil {
 		log.Printf("image load error: %v", err)
-		img = ebiten.NewImage(1, 1)
+		img := ebiten.NewImage(1, 1)
 		img.Fill(color.RGBA{255, 0, 255, 255})
+		si = stageImage{Image: img}
+		v.Density = 1
 	}
-	cache[file] = img
-	return img
-}
-
-func (r *StageRenderer) draw(dst *ebiten.Image, st *script.StageInfo) {
-	if st != nil {
-		if st.BG != "" && st.BG != r.currBG {
-			if st.BGFade > 0 {
-				r.prevBG = r.currBG
-				r.currBG = st.BG
-				r.bgFadeFrames = st.BGFade
-				r.bgFadeCounter = 0
-			} else {
-				r.prevBG = ""
-				r.currBG = st.BG
-				r.bgFadeFrames = 0
-			}
-		}
+	si.density = v.Density
+	cache[file] = si
+	return si
+}
 
-		if !spritesEqual(st.Sprites, r.currSprites) {
-			if st.SpriteFade > 0 {
-				r.prevSprites = r.currSprites
-				r.currSprites = append([]script.SpriteInfo(nil), st.Sprites...)
-				r.spriteFadeFrames = st.SpriteFade
-				r.spriteFadeCounter = 0
-			} else {
-				r.prevSprites = nil
-				r.currSprites = append([]script.SpriteInfo(nil), st.Sprites...)
-				r.spriteFadeFrames = 0
-			}
-		}
+// sprite returns the image for s. Layered sprites are composed from their
+// parts on first use and cached under the combination of parts; parts
+// outside the body are clipped.
+func (r *StageRenderer) sprite(s script.SpriteInfo) stageImage {
+	parts := spriteParts(r.cast, s)
+	if len(parts) == 1 && parts[0].Offset == [2]float64{} {
+		return r.load(r.spriteCache, "sprites", parts[0].File)
 	}
+	key := partsKey(parts)
+	if img, ok := r.spriteCache[key]; ok {
+		return img
+	}
+	body := r.load(r.partCache, "sprites", parts[0].File)
+	img := ebiten.NewImage(body.Bounds().Dx(), body.Bounds().Dy())
+	for _, p := range parts {
+		part := r.load(r.partCache, "sprites", p.File)
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(body.density/part.density, body.density/part.density)
+		op.GeoM.Translate(p.Offset[0]*body.density, p.Offset[1]*body.density)
+		img.DrawImage(part.Image, op)
+	}
+	si := stageImage{Image: img, density: body.density}
+	r.spriteCache[key] = si
+	return si
+}
 
-	r.drawBackground(dst)
-	r.drawSprites(dst)
+// clearCache drops every loaded image so the next draw reads them from disk.
+func (r *StageRenderer) clearCache() {
+	r.bgCache = map[string]stageImage{}
+	r.spriteCache = map[string]stageImage{}
+	r.partCache = map[string]stageImage{}
+	r.portraitCache = map[string]stageImage{}
+	r.particleCache = map[string]stageImage{}
+	r.planeCache = map[string]map[string]stageImage{}
+	r.orders = map[string][]float64{}
 }
 
-func (r *StageRenderer) drawBackground(dst *ebiten.Image) {
-	if r.bgFadeFrames == 0 {
-		if r.currBG != "" {
-			bg := r.load(r.bgCache, "bg", r.currBG)
-			op := &ebiten.DrawImageOptions{}
-			bw, bh := bg.Size()
-			op.GeoM.Scale(float64(r.screenW)/float64(bw), float64(r.screenH)/float64(bh))
-			dst.DrawImage(bg, op)
-		} else {
-			dst.DrawImage(r.black, nil)
-		}
-		return
+// setRenderScale tells the renderer how much the stage is enlarged on the
+// screen. When that calls for assets of another density the caches are
+// dropped so the matching variants are loaded.
+func (r *StageRenderer) setRenderScale(scale float64) {
+	if d := renderDensity(scale); d != r.density {
+		r.density = d
+		r.clearCache()
 	}
+}
 
-	ratio := float64(r.bgFadeCounter) / float64(r.bgFadeFrames)
-
-	if r.prevBG != "" {
-		bg := r.load(r.bgCache, "bg", r.prevBG)
-		op := &ebiten.DrawImageOptions{}
-		bw, bh := bg.Size()
-		op.GeoM.Scale(float64(r.screenW)/float64(bw), float64(r.screenH)/float64(bh))
-		op.ColorScale.ScaleAlpha(float32(1 - ratio))
-		dst.DrawImage(bg, op)
+// draw draws the stage followed by the screen effects, the overlay, which
+// the camera does not move, and any flash.
+func (r *StageRenderer) draw(dst *ebiten.Image, snap StageSnapshot) {
+	r.clock = snap.Clock
+	if !snap.Effects.Active() {
+		r.drawStage(dst, snap)
 	} else {
-		op := &ebiten.DrawImageOptions{}
-		op.ColorScale.ScaleAlpha(float32(1 - ratio))
-		dst.DrawImage(r.black, op)
+		r.post.Clear()
+		r.drawStage(r.post, snap)
+		r.drawEffects(dst, snap.Effects)
 	}
+	r.view = ebiten.GeoM{}
+	r.drawPlane(dst, planeOverlay, snap.Overlay)
+	if snap.FlashAlpha > 0 {
+		c, err := character.ParseColor(snap.Flash)
+		if err != nil {
+			c = color.RGBA{255, 255, 255, 255}
+		}
+		c.A = uint8(float64(c.A) * snap.FlashAlpha)
+		r.drawFill(dst, c)
+	}
+}
 
-	if r.currBG != "" {
-		bg := r.load(r.bgCache, "bg", r.currBG)
-		op := &ebiten.DrawImageOptions{}
-		bw, bh := bg.Size()
-		op.GeoM.Scale(float64(r.screenW)/float64(bw), float64(r.screenH)/float64(bh))
-		op.ColorScale.ScaleAlpha(float32(ratio))
-		dst.DrawImage(bg, op)
-	} else {
-		op := &ebiten.DrawImageOptions{}
-		op.ColorScale.ScaleAlpha(float32(ratio))
-		dst.DrawImage(r.black, op)
+// drawStage draws the background, sprites, foreground and CG through the
+// camera and any screen motion, and the particles over them as they fall on
+// the screen. A CG that is fully shown hides everything beneath it.
+func (r *StageRenderer) drawStage(dst *ebiten.Image, snap StageSnapshot) {
+	r.cameraBG = snap.Camera.Zoom > 0 || (snap.CameraProgress < 1 && snap.CameraFrom.Zoom > 0)
+	r.view = r.viewTransform(snap)
+	if !snap.CG.Shown() {
+		r.drawBackground(dst, snap)
+		r.drawSprites(dst, snap)
+		r.drawPlane(dst, planeForeground, snap.Foreground)
 	}
+	r.drawPlane(dst, planeCG, snap.CG)
+	r.drawParticles(dst, snap.Particles)
+}
 
-	if r.bgFadeCounter < r.bgFadeFrames {
-		r.bgFadeCounter++
+// viewTransform combines the camera with the screen motion of snap. The
+// camera moves over the background, or the screen when there is none.
+func (r *StageRenderer) viewTransform(snap StageSnapshot) ebiten.GeoM {
+	sw, sh := float64(r.screenW), float64(r.screenH)
+	world := stageRect{0, 0, sw, sh}
+	if r.cameraBG && snap.BG != "" {
+		iw, ih := r.load(r.bgCache, "bg", snap.BG).size()
+		world = cameraWorld(sw, sh, iw, ih)
 	}
+	focus := func(id string) (float64, float64, bool) { return r.spriteFocus(snap, id) }
+	v := lerpView(resolveCamera(snap.CameraFrom, world, sw, sh, focus), resolveCamera(snap.Camera, world, sw, sh, focus), snap.CameraProgress)
+	var g ebiten.GeoM
+	scale, tx, ty := v.transform(sw, sh)
+	g.Scale(scale, scale)
+	g.Translate(tx, ty)
+	if sm := snap.Screen; sm.Zoom > 0 && sm.Zoom != 1 {
+		g.Translate(-sw/2, -sh/2)
+		g.Scale(sm.Zoom, sm.Zoom)
+		g.Translate(sw/2, sh/2)
+	}
+	g.Translate(snap.Screen.OffsetX, snap.Screen.OffsetY)
+	return g
 }
 
-func (r *StageRenderer) drawSprites(dst *ebiten.Image) {
-	if r.spriteFadeFrames == 0 {
-		r.drawSpriteSet(dst, r.currSprites, 1)
+// spriteFocus returns the point a camera focusing on sprite id centres on,
+// a third of the way down the image, in stage coordinates.
+func (r *StageRenderer) spriteFocus(snap StageSnapshot, id string) (x, y float64, ok bool) {
+	for i := len(snap.Sprites) - 1; i >= 0; i-- {
+		s := snap.Sprites[i].Info
+		if s.ID != id {
+			continue
+		}
+		w, h := r.sprite(s).size()
+		sw, sh := float64(r.screenW), float64(r.screenH)
+		pl := placeSprite(s, r.cfg.Positions, sw, sh, w, h)
+		return pl.X + w*pl.Scale/2, pl.Y + h*pl.Scale/3, true
+	}
+	return 0, 0, false
+}
+
+func (r *StageRenderer) drawBackground(dst *ebiten.Image, snap StageSnapshot) {
+	if snap.BGProgress >= 1 {
+		r.drawBGAt(dst, snap.BG, snap.BGStart, 1, 0, 0)
 		return
 	}
+	draw := func(dst *ebiten.Image, file string, alpha, dx, dy float64) {
+		start := snap.BGStart
+		if file != snap.BG {
+			start = snap.PrevBGStart
+		}
+		r.drawBGAt(dst, file, start, alpha, dx, dy)
+	}
+	r.drawTransition(dst, snap.PrevBG, snap.BG, snap.BGProgress, snap.BGTransition, true, draw)
+}
 
-	ratio := float64(r.spriteFadeCounter) / float64(r.spriteFadeFrames)
-	r.drawSpriteSet(dst, r.prevSprites, 1-ratio)
-	r.drawSpriteSet(dst, r.currSprites, ratio)
+// drawBGAt draws a background that appeared at start fitted to the screen,
+// or laid out for the camera while it is in use, or black when file is
+// empty, displaced by (dx, dy).
+func (r *StageRenderer) drawBGAt(dst *ebiten.Image, file string, start time.Duration, alpha, dx, dy float64) {
+	if file == "" {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(dx, dy)
+		op.GeoM.Concat(r.view)
+		op.ColorScale.ScaleAlpha(float32(alpha))
+		dst.DrawImage(r.black, op)
+		return
+	}
+	fit := r.cfg.BackgroundFor(file)
+	if r.cameraBG {
+		fit.Fit = fitCamera
+	}
+	r.drawFitted(dst, r.load(r.bgCache, "bg", file), start, fit, alpha, dx, dy)
+}
 
-	if r.spriteFadeCounter < r.spriteFadeFrames {
-		r.spriteFadeCounter++
+// drawPlane draws a full-screen layer, through its transition while its
+// image changes.
+func (r *StageRenderer) drawPlane(dst *ebiten.Image, name string, l PlaneLayer) {
+	draw := func(dst *ebiten.Image, file string, alpha, dx, dy float64) {
+		start := l.Start
+		if file != l.File {
+			start = l.PrevStart
+		}
+		r.drawPlaneAt(dst, name, file, start, alpha, dx, dy)
+	}
+	if l.Progress >= 1 {
+		draw(dst, l.File, 1, 0, 0)
+		return
 	}
+	r.drawTransition(dst, l.Prev, l.File, l.Progress, l.Transition, false, draw)
 }
 
-func (r *StageRenderer) drawSpriteSet(dst *ebiten.Image, sprites []script.SpriteInfo, alpha float64) {
-	if alpha <= 0 {
+// drawPlaneAt draws an image of the layer name that appeared at start,
+// displaced by (dx, dy). CGs are fitted like backgrounds and other layers
+// stretched over the screen; an empty file draws nothing.
+func (r *StageRenderer) drawPlaneAt(dst *ebiten.Image, name, file string, start time.Duration, alpha, dx, dy float64) {
+	if file == "" {
 		return
 	}
-	for _, s := range sprites {
-		sp := r.load(r.spriteCache, "sprites", s.File)
-		var x float64
-		switch s.Pos {
-		case "left":
-			x = float64(r.screenW)*0.2 - float64(sp.Bounds().Dx())/2
-		case "center":
-			x = float64(r.screenW)*0.5 - float64(sp.Bounds().Dx())/2
-		case "right":
-			x = float64(r.screenW)*0.8 - float64(sp.Bounds().Dx())/2
-		default:
-			x = 0
-		}
-		y := float64(r.screenH) - float64(sp.Bounds().Dy())
-		op := &ebiten.DrawImageOptions{}
-		op.GeoM.Translate(x, y)
-		if alpha < 1 {
-			op.ColorScale.ScaleAlpha(float32(alpha))
+	cache, ok := r.planeCache[name]
+	if !ok {
+		cache = map[string]stageImage{}
+		r.planeCache[name] = cache
+	}
+	fit := project.Background{Fit: project.FitStretch}
+	if name == planeCG {
+		fit = r.cfg.BackgroundFor(file)
+	}
+	r.drawFitted(dst, r.load(cache, name, file), start, fit, alpha, dx, dy)
+}
+
+// drawFitted draws img, which appeared at start, fitted to the screen by fit
+// through the view, filling whatever it leaves uncovered with the fit's
+// colour.
+func (r *StageRenderer) drawFitted(dst *ebiten.Image, img stageImage, start time.Duration, fit project.Background, alpha, dx, dy float64) {
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(dx, dy)
+	op.GeoM.Concat(r.view)
+	if alpha < 1 {
+		op.ColorScale.ScaleAlpha(float32(alpha))
+	}
+	iw, ih := img.size()
+	pl := fitBackground(fit.Fit, float64(r.screenW), float64(r.screenH), iw, ih)
+	if !pl.Covers {
+		c, err := character.ParseColor(fit.Color)
+		if err != nil {
+			c = color.RGBA{A: 255}
 		}
-		dst.DrawImage(sp, op)
+		fill := &ebiten.DrawImageOptions{ColorScale: op.ColorScale}
+		fill.GeoM.Scale(float64(r.screenW), float64(r.screenH))
+		fill.GeoM.Concat(op.GeoM)
+		// Parsed colours are not premultiplied.
+		fill.ColorScale.ScaleWithColor(color.NRGBA(c))
+		dst.DrawImage(r.white, fill)
+	}
+	var geo ebiten.GeoM
+	geo.Scale(pl.SX/img.density, pl.SY/img.density)
+	geo.Translate(pl.X, pl.Y)
+	geo.Concat(op.GeoM)
+	op.GeoM = geo
+	if img.density != 1 || r.view != (ebiten.GeoM{}) {
+		op.Filter = ebiten.FilterLinear
 	}
+	dst.DrawImage(img.at(r.clock-start), op)
 }
 
-func spritesEqual(a, b []script.SpriteInfo) bool {
-	if len(a) != len(b) {
-		return false
+func (r *StageRenderer) drawSprites(dst *ebiten.Image, snap StageSnapshot) {
+	hl := r.cfg.Highlight
+	layers := snap.Sprites
+	if hl.Enabled && hl.Front {
+		layers = append([]SpriteLayer(nil), layers...)
+		speakerToFront(layers, snap.Speaker)
 	}
-	for i := range a {
-		if a[i].File != b[i].File || a[i].Pos != b[i].Pos {
-			return false
+	for _, l := range layers {
+		talking := snap.Talking && isSpeaker(l.Info, snap.Speaker)
+		s := animateSprite(r.cast, l.Info, snap.Clock, talking)
+		mo := l.Motion
+		if talking {
+			mo.OffsetY += highlightBob(hl, l.Highlight, snap.Clock)
 		}
+		r.drawSprite(dst, s, l.Start, l.Alpha, mo, highlightTone(hl, l.Highlight))
+	}
+}
+
+// drawSprite draws sprite s, whose image appeared at start.
+func (r *StageRenderer) drawSprite(dst *ebiten.Image, s script.SpriteInfo, start time.Duration, alpha float64, mo SpriteMotion, tone spriteTone) {
+	if alpha <= 0 {
+		return
+	}
+	sp := r.sprite(s)
+	w, h := sp.size()
+	sw, sh := float64(r.screenW), float64(r.screenH)
+	if mo.Scale > 0 {
+		s.Scale = mo.Scale
+	}
+	pl := placeSprite(s, r.cfg.Positions, sw, sh, w, h)
+	if mo.MoveFrom != nil {
+		from := *mo.MoveFrom
+		from.Scale = s.Scale
+		fp := placeSprite(from, r.cfg.Positions, sw, sh, w, h)
+		pl.X = anim.Lerp(fp.X, pl.X, mo.MoveProgress)
+		pl.Y = anim.Lerp(fp.Y, pl.Y, mo.MoveProgress)
+	}
+	pl.X += mo.SlideX*sw + mo.OffsetX
+	pl.Y += mo.SlideY*sh + mo.OffsetY
+	alpha *= pl.Alpha
+	if alpha <= 0 {
+		return
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(1/sp.density, 1/sp.density)
+	if pl.Flip {
+		op.GeoM.Scale(-1, 1)
+		op.GeoM.Translate(w, 0)
+	}
+	op.GeoM.Scale(pl.Scale, pl.Scale)
+	op.GeoM.Translate(pl.X, pl.Y)
+	op.GeoM.Concat(r.view)
+	if pl.Scale != 1 || sp.density != 1 || r.view != (ebiten.GeoM{}) {
+		op.Filter = ebiten.FilterLinear
+	}
+	if tone.Sat < 1 {
+		var cm colorm.ColorM
+		cm.ChangeHSV(0, tone.Sat, tone.Bright)
+		cm.Scale(1, 1, 1, alpha)
+		colorm.DrawImage(dst, sp.at(r.clock-start), cm, &colorm.DrawImageOptions{GeoM: op.GeoM, Filter: op.Filter})
+		return
+	}
+	b := float32(tone.Bright)
+	op.ColorScale.Scale(b, b, b, 1)
+	if alpha < 1 {
+		op.ColorScale.ScaleAlpha(float32(alpha))
 	}
-	return true
+	dst.DrawImage(sp.at(r.clock-start), op)
 }
@@ -0,0 +1,72 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// quickSavePath is where the quick save slot is written.
+var quickSavePath = filepath.Join("save", "quick.json")
+
+// SavedLine is a backlog line in a save file.
+type SavedLine struct {
+	Speaker string `json:"speaker,omitempty"`
+	Text    string `json:"text"`
+	Step    int    `json:"step"`
+}
+
+// SaveData is what a save file holds. History is every page visited and
+// Stages and Audio the stage and mixer state on each of them, so that
+// rolling back keeps working after loading.
+type SaveData struct {
+	History []int             `json:"history"`
+	Stages  []StageState      `json:"stages"`
+	Audio   []MixerState      `json:"audio"`
+	Backlog []SavedLine       `json:"backlog,omitempty"`
+	Vars    map[string]string `json:"vars,omitempty"`
+}
+
+// check reports whether the save can be resumed in a script of pages pages.
+func (d *SaveData) check(pages int) error {
+	if len(d.History) == 0 || len(d.History) != len(d.Stages) || len(d.History) != len(d.Audio) {
+		return fmt.Errorf("save: %d pages visited with %d stage and %d audio states",
+			len(d.History), len(d.Stages), len(d.Audio))
+	}
+	for _, i := range d.History {
+		if i < 0 || i >= pages {
+			return fmt.Errorf("save: page %d is not in the script", i)
+		}
+	}
+	return nil
+}
+
+// WriteSave writes d to path, creating its directory if needed.
+func WriteSave(path string, d *SaveData) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ReadSave reads a save file written by WriteSave and checks it against a
+// script of pages pages.
+func ReadSave(path string, pages int) (*SaveData, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var d SaveData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	if err := d.check(pages); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
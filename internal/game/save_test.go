@@ -0,0 +1,70 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "save", "quick.json")
+	d := &SaveData{
+		History: []int{0, 2},
+		Stages: []StageState{
+			{BG: "room.jpg"},
+			{BG: "room.jpg", Effects: ScreenEffects{Filter: "sepia"}, Particles: []string{"rain"}},
+		},
+		Audio: []MixerState{
+			{BGM: MixerTrack{File: "audio/town.mp3"}},
+			{
+				Volumes: map[string]float64{"bgm": 0.5, "se": 0},
+				BGM:     MixerTrack{File: "audio/town.mp3", Volume: f64p(0.8)},
+				Ambient: MixerTrack{File: "audio/rain.mp3", Volume: f64p(0)},
+			},
+		},
+		Backlog: []SavedLine{{Speaker: "クロ", Text: "おはよう", Step: 0}},
+		Vars:    map[string]string{"met": "yes"},
+	}
+	if err := WriteSave(path, d); err != nil {
+		t.Fatalf("WriteSave error: %v", err)
+	}
+	got, err := ReadSave(path, 3)
+	if err != nil {
+		t.Fatalf("ReadSave error: %v", err)
+	}
+	if !reflect.DeepEqual(got, d) {
+		t.Fatalf("got %+v, want %+v", got, d)
+	}
+	m := got.Audio[1]
+	if m.Volume("bgm") != 0.5 || m.Volume("se") != 0 || m.Volume("voice") != 1 {
+		t.Fatalf("channel volumes = %v", m.Volumes)
+	}
+	if m.BGM.Gain() != 0.8 || m.Ambient.File != "audio/rain.mp3" || m.Ambient.Gain() != 0 {
+		t.Fatalf("tracks = %+v, %+v", m.BGM, m.Ambient)
+	}
+}
+
+func TestReadSaveChecksScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quick.json")
+	if err := WriteSave(path, &SaveData{History: []int{0, 5}, Stages: make([]StageState, 2), Audio: make([]MixerState, 2)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSave(path, 3); err == nil {
+		t.Fatal("a page past the end of the script should be rejected")
+	}
+	if err := WriteSave(path, &SaveData{History: []int{0}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSave(path, 3); err == nil {
+		t.Fatal("a save without stage states should be rejected")
+	}
+	if err := WriteSave(path, &SaveData{History: []int{0}, Stages: make([]StageState, 1)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSave(path, 3); err == nil {
+		t.Fatal("a save without audio states should be rejected")
+	}
+}
@@ -0,0 +1,74 @@
+//go:build !headless
+// +build !headless
+
+package game
+
+import (
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/colorm"
+)
+
+// drawEffects draws the stage held in r.post to dst through the screen
+// effects l: blur, then the colour filters, then tint and vignette.
+func (r *StageRenderer) drawEffects(dst *ebiten.Image, l EffectLevels) {
+	src := r.post
+	if l.Blur > 0 {
+		src = r.blur(src, l.Blur)
+	}
+
+	var cm colorm.ColorM
+	m := filterMatrix(l)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			cm.SetElement(i, j, m[i][j])
+		}
+	}
+	colorm.DrawImage(dst, src, cm, &colorm.DrawImageOptions{})
+
+	if l.Tint.A > 0 {
+		r.drawFill(dst, l.Tint)
+	}
+	if l.Vignette > 0 {
+		op := &ebiten.DrawImageOptions{}
+		op.ColorScale.ScaleAlpha(float32(l.Vignette))
+		dst.DrawImage(r.vignette, op)
+	}
+}
+
+// blur softens src by drawing it shrunk and enlarging it again with linear
+// filtering. The result is only valid until the next draw.
+func (r *StageRenderer) blur(src *ebiten.Image, radius float64) *ebiten.Image {
+	f := 1 + radius/2
+	r.scratch.Clear()
+	op := &ebiten.DrawImageOptions{Filter: ebiten.FilterLinear}
+	op.GeoM.Scale(1/f, 1/f)
+	r.scratch.DrawImage(src, op)
+	r.layer.Clear()
+	op = &ebiten.DrawImageOptions{Filter: ebiten.FilterLinear}
+	op.GeoM.Scale(f, f)
+	r.layer.DrawImage(r.scratch, op)
+	return r.layer
+}
+
+// drawFill covers dst with c, whose alpha is its opacity.
+func (r *StageRenderer) drawFill(dst *ebiten.Image, c color.RGBA) {
+	a := float32(c.A) / 255
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(r.screenW), float64(r.screenH))
+	op.ColorScale.Scale(float32(c.R)/255*a, float32(c.G)/255*a, float32(c.B)/255*a, a)
+	dst.DrawImage(r.white, op)
+}
+
+func newVignette(w, h int) *ebiten.Image {
+	pix := make([]byte, 4*w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			pix[4*(y*w+x)+3] = byte(vignetteAlpha(x, y, w, h)*255 + 0.5)
+		}
+	}
+	img := ebiten.NewImage(w, h)
+	img.WritePixels(pix)
+	return img
+}
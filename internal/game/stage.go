@@ -0,0 +1,647 @@
+package game
+
+import (
+	"maps"
+	"math"
+	"time"
+
+	"novegido/internal/anim"
+	"novegido/internal/character"
+	"novegido/internal/script"
+)
+
+// StageState is the persistent part of the stage: what is shown once every
+// transition has finished. It is recorded for each visited page so that
+// rolling back can restore it.
+type StageState struct {
+	BG      string              `json:"bg"`
+	Sprites []script.SpriteInfo `json:"sprites"`
+	Effects ScreenEffects       `json:"effects"`
+	Camera  Camera              `json:"camera"`
+	// Particles are the running particle emitters by name.
+	Particles []string `json:"particles,omitempty"`
+	// Foreground, CG and Overlay are the images of the full-screen layers.
+	Foreground string `json:"foreground,omitempty"`
+	CG         string `json:"cg,omitempty"`
+	Overlay    string `json:"overlay,omitempty"`
+}
+
+// applyStage returns the state that results from applying the operations of
+// st to state. The sprite replacement happens first, followed by hides,
+// shows, expression changes, layer changes and moves. Screen effects, the
+// camera, particle emitters and full-screen layers are updated last.
+func applyStage(state StageState, st *script.StageInfo) StageState {
+	if st == nil {
+		return state
+	}
+	next := StageState{
+		BG:      state.BG,
+		Effects: applyEffect(state.Effects, st.Effect),
+		Camera:  applyCamera(state.Camera, st.Camera),
+
+		Particles:  applyParticles(state.Particles, st.Particles),
+		Foreground: applyLayer(state.Foreground, st.Foreground),
+		CG:         applyLayer(state.CG, st.CG),
+		Overlay:    applyLayer(state.Overlay, st.Overlay),
+	}
+	if st.BG != "" {
+		next.BG = st.BG
+	}
+	sprites := state.Sprites
+	if st.Sprites != nil {
+		sprites = st.Sprites
+	}
+	next.Sprites = append([]script.SpriteInfo(nil), sprites...)
+
+	for _, id := range st.Hide {
+		if i := spriteIndex(next.Sprites, id); i >= 0 {
+			next.Sprites = append(next.Sprites[:i], next.Sprites[i+1:]...)
+		}
+	}
+	for _, s := range st.Show {
+		i := spriteIndex(next.Sprites, s.ID)
+		if i < 0 {
+			next.Sprites = append(next.Sprites, s)
+			continue
+		}
+		cur := &next.Sprites[i]
+		if s.File == "" && s.Expr == "" {
+			s.File, s.Expr = cur.File, cur.Expr
+		}
+		if s.Layers == nil {
+			s.Layers = cur.Layers
+		}
+		if s.Pos == "" && s.X == nil && s.Y == nil {
+			s.Pos, s.X, s.Y = cur.Pos, cur.X, cur.Y
+		}
+		*cur = s
+	}
+	for id, expr := range st.Expr {
+		if i := spriteIndex(next.Sprites, id); i >= 0 {
+			cur := &next.Sprites[i]
+			if ref, _, ok := character.SplitRef(cur.File); ok {
+				cur.File = ref + ":" + expr
+			} else {
+				cur.File = ""
+			}
+			cur.Expr = expr
+		}
+	}
+	for id, layers := range st.Layers {
+		if i := spriteIndex(next.Sprites, id); i >= 0 {
+			cur := &next.Sprites[i]
+			merged := maps.Clone(cur.Layers)
+			if merged == nil {
+				merged = map[string]string{}
+			}
+			maps.Copy(merged, layers)
+			cur.Layers = merged
+		}
+	}
+	for id, pos := range st.Move {
+		if i := spriteIndex(next.Sprites, id); i >= 0 {
+			cur := &next.Sprites[i]
+			cur.Pos, cur.X, cur.Y = pos, nil, nil
+		}
+	}
+	return next
+}
+
+func spriteIndex(sprites []script.SpriteInfo, id string) int {
+	for i, s := range sprites {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// spriteTrack follows one sprite ID across page changes so that each sprite
+// transitions on its own. A track either fades in, crossfades from prev to
+// info, fades out while leaving, or is steady.
+type spriteTrack struct {
+	info    script.SpriteInfo
+	prev    script.SpriteInfo
+	hasPrev bool
+	// shown and prevShown are the stage times info and prev appeared,
+	// from which their animations play.
+	shown     time.Duration
+	prevShown time.Duration
+	leaving   bool
+	fade      time.Duration
+	elapsed   time.Duration
+	easing    anim.Easing
+	motions   []*motion
+}
+
+func (t *spriteTrack) start(fade time.Duration, easing anim.Easing) {
+	t.fade = fade
+	t.elapsed = 0
+	t.easing = easing
+}
+
+func (t *spriteTrack) done() bool { return t.elapsed >= t.fade }
+
+// SpriteLayer is one sprite image to draw with the given opacity and
+// motion. A sprite that is crossfading contributes two layers. Highlight
+// is 1 for the speaker, and for everyone when no one on stage speaks, and 0
+// for the rest. Start is the stage time the image appeared, which its
+// animation plays from.
+type SpriteLayer struct {
+	Info      script.SpriteInfo
+	Alpha     float64
+	Motion    SpriteMotion
+	Highlight float64
+	Start     time.Duration
+}
+
+// Stage is the logical state of the background and sprites. Page changes are
+// applied once with Apply and time is advanced once per tick by Update; it is
+// never touched while drawing. Renderers only see the read-only
+// StageSnapshot it produces.
+type Stage struct {
+	bg        string
+	prevBG    string
+	bgFade    time.Duration
+	bgElapsed time.Duration
+	bgEasing  anim.Easing
+	bgTrans   script.TransitionInfo
+	// bgStart and prevBGStart are the stage times bg and prevBG appeared.
+	bgStart     time.Duration
+	prevBGStart time.Duration
+
+	tracks []*spriteTrack
+	screen []*motion
+
+	effects     ScreenEffects
+	prevEffects ScreenEffects
+	effectFade  anim.Tween
+	flash       string
+	flashFade   anim.Tween
+
+	camera     Camera
+	prevCamera Camera
+	cameraMove anim.Tween
+
+	particles []string
+
+	foreground plane
+	cg         plane
+	overlay    plane
+
+	// clock is the time the stage has been running, which drives idle
+	// animations.
+	clock time.Duration
+
+	// speaker is the ID of the speaking character and highlight how lit
+	// each sprite is, moving towards its target over highlightFade.
+	speaker       string
+	highlight     map[string]float64
+	highlightFade time.Duration
+}
+
+// StageSnapshot is an immutable view of a Stage at one point in time.
+// BGProgress is already eased and is 1 once the transition is done.
+type StageSnapshot struct {
+	BG         string
+	PrevBG     string
+	BGProgress float64
+	// BGTransition is how PrevBG gives way to BG while BGProgress < 1.
+	BGTransition script.TransitionInfo
+	// BGStart and PrevBGStart are the stage times the backgrounds
+	// appeared, which their animations play from.
+	BGStart     time.Duration
+	PrevBGStart time.Duration
+	Sprites     []SpriteLayer
+	Screen      ScreenMotion
+	// Foreground is drawn over the sprites and CG over that. Effects are
+	// drawn over the stage, followed by Overlay and Flash, a colour at
+	// FlashAlpha.
+	Foreground PlaneLayer
+	CG         PlaneLayer
+	Overlay    PlaneLayer
+	Effects    EffectLevels
+	Flash      string
+	FlashAlpha float64
+	// The camera moves from CameraFrom to Camera; CameraProgress is eased
+	// and is 1 once it arrives.
+	CameraFrom     Camera
+	Camera         Camera
+	CameraProgress float64
+	// Clock drives idle animations. Speaker and Talking are not part of the
+	// stage; the game fills them in so that the speaking sprite, matched by
+	// the character it shows or its ID, moves its mouth.
+	Clock   time.Duration
+	Speaker string
+	Talking bool
+	// Particles are drawn over the sprites. The game fills them in from
+	// its particle field, which runs the stage's emitters.
+	Particles []Particle
+}
+
+// NewStage returns an empty stage with a black background.
+func NewStage() *Stage {
+	return &Stage{bgEasing: anim.Linear}
+}
+
+// spriteFade returns the fade used for sprite s on a page whose default
+// sprite fade is def.
+func spriteFade(s script.SpriteInfo, def time.Duration) time.Duration {
+	if s.FadeMs > 0 {
+		return time.Duration(s.FadeMs) * time.Millisecond
+	}
+	return def
+}
+
+// Apply performs the stage operations of a newly entered page, starting
+// transitions for whatever changed. Sprites are matched by ID: unchanged
+// sprites stay solid, new ones fade in, removed ones fade out and a change
+// of image crossfades in place.
+func (s *Stage) Apply(st *script.StageInfo) {
+	if st == nil {
+		return
+	}
+	next := applyStage(s.State(), st)
+	easing := anim.EasingByName(st.Easing)
+	if next.BG != s.bg {
+		s.prevBG = s.bg
+		s.bg = next.BG
+		s.prevBGStart = s.bgStart
+		s.bgStart = s.clock
+		s.bgFade = st.BGFadeDuration()
+		s.bgElapsed = 0
+		s.bgEasing = easing
+		s.bgTrans = script.TransitionInfo{}
+		if st.Transition != nil {
+			s.bgTrans = *st.Transition
+		}
+	}
+
+	def := st.SpriteFadeDuration()
+	var tracks []*spriteTrack
+	for _, t := range s.tracks {
+		if t.leaving {
+			if spriteIndex(next.Sprites, t.info.ID) < 0 {
+				tracks = append(tracks, t)
+			}
+			continue
+		}
+		i := spriteIndex(next.Sprites, t.info.ID)
+		if i < 0 {
+			t.leaving = true
+			t.hasPrev = false
+			t.start(spriteFade(t.info, def), easing)
+			if !t.done() {
+				tracks = append(tracks, t)
+			}
+			continue
+		}
+		n := next.Sprites[i]
+		if n.File != t.info.File || n.Expr != t.info.Expr || !maps.Equal(n.Layers, t.info.Layers) {
+			t.prev = t.info
+			t.hasPrev = true
+			t.prevShown = t.shown
+			t.shown = s.clock
+			t.start(spriteFade(n, def), easing)
+		}
+		t.info = n
+		tracks = append(tracks, t)
+	}
+	for _, n := range next.Sprites {
+		if s.track(tracks, n.ID) != nil {
+			continue
+		}
+		t := &spriteTrack{info: n, shown: s.clock}
+		t.start(spriteFade(n, def), easing)
+		tracks = append(tracks, t)
+	}
+	s.tracks = tracks
+	s.startMotions(st.Motion)
+	s.particles = next.Particles
+	s.foreground.change(next.Foreground, st.Foreground, s.clock)
+	s.cg.change(next.CG, st.CG, s.clock)
+	s.overlay.change(next.Overlay, st.Overlay, s.clock)
+
+	if next.Effects != s.effects {
+		s.prevEffects = s.effects
+		s.effects = next.Effects
+		s.effectFade = anim.NewTween(time.Duration(st.Effect.FadeMs)*time.Millisecond, easing)
+	}
+	if c := st.Camera; c != nil {
+		s.prevCamera = s.camera
+		if c.From != nil {
+			s.prevCamera = applyCamera(Camera{}, c.From)
+		}
+		s.camera = next.Camera
+		s.cameraMove = anim.NewTween(time.Duration(c.DurationMs)*time.Millisecond, anim.EasingByName(c.Easing))
+	}
+	if st.Effect != nil && st.Effect.Flash != "" {
+		d := time.Duration(st.Effect.FlashMs) * time.Millisecond
+		if d <= 0 {
+			d = defaultFlash
+		}
+		s.flash = st.Effect.Flash
+		s.flashFade = anim.NewTween(d, anim.EaseOut)
+	}
+}
+
+// startMotions starts the motions of a page. Moves and zooms take effect on
+// the persistent sprite state at once and are animated from where the sprite
+// was; motions naming a sprite that is not shown are ignored.
+func (s *Stage) startMotions(motions []script.MotionInfo) {
+	for _, m := range motions {
+		if m.Target == script.MotionTargetScreen {
+			s.screen = append(s.screen, newMotion(m, script.SpriteInfo{}))
+			continue
+		}
+		t := s.track(s.tracks, m.Target)
+		if t == nil {
+			continue
+		}
+		from := t.info
+		if !applyMotion(&t.info, m) {
+			continue
+		}
+		t.motions = append(t.motions, newMotion(m, from))
+	}
+}
+
+// track returns the visible (not leaving) track for id.
+func (s *Stage) track(tracks []*spriteTrack, id string) *spriteTrack {
+	for _, t := range tracks {
+		if !t.leaving && t.info.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// Update advances any running transitions by dt.
+func (s *Stage) Update(dt time.Duration) {
+	s.clock += dt
+	s.updateHighlight(dt)
+	if s.bgElapsed < s.bgFade {
+		s.bgElapsed += dt
+	}
+	for _, t := range s.tracks {
+		if !t.done() {
+			t.elapsed += dt
+		}
+		for _, m := range t.motions {
+			m.tween.Update(dt)
+		}
+	}
+	for _, m := range s.screen {
+		m.tween.Update(dt)
+	}
+	s.effectFade.Update(dt)
+	s.flashFade.Update(dt)
+	s.cameraMove.Update(dt)
+	for _, p := range s.planes() {
+		p.fade.Update(dt)
+	}
+	s.prune()
+}
+
+// planes returns the full-screen layers from back to front.
+func (s *Stage) planes() []*plane {
+	return []*plane{&s.foreground, &s.cg, &s.overlay}
+}
+
+// SetSpeaker tells the stage which character is speaking so that sprites
+// can be highlighted; the highlight moves to a new speaker over fade.
+func (s *Stage) SetSpeaker(id string, fade time.Duration) {
+	s.speaker = id
+	s.highlightFade = fade
+}
+
+// highlightTarget is the highlight sprite info is heading towards.
+func (s *Stage) highlightTarget(info script.SpriteInfo) float64 {
+	if s.speaker == "" || isSpeaker(info, s.speaker) || !s.speakerShown() {
+		return 1
+	}
+	return 0
+}
+
+// speakerShown reports whether the speaker is one of the visible sprites.
+func (s *Stage) speakerShown() bool {
+	for _, t := range s.tracks {
+		if !t.leaving && isSpeaker(t.info, s.speaker) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Stage) updateHighlight(dt time.Duration) {
+	if s.highlight == nil {
+		s.highlight = map[string]float64{}
+	}
+	step := 1.0
+	if s.highlightFade > 0 {
+		step = float64(dt) / float64(s.highlightFade)
+	}
+	seen := map[string]bool{}
+	for _, t := range s.tracks {
+		id := t.info.ID
+		seen[id] = true
+		target := s.highlightTarget(t.info)
+		cur, ok := s.highlight[id]
+		switch {
+		case !ok:
+			cur = target
+		case cur < target:
+			cur = math.Min(target, cur+step)
+		case cur > target:
+			cur = math.Max(target, cur-step)
+		}
+		s.highlight[id] = cur
+	}
+	for id := range s.highlight {
+		if !seen[id] {
+			delete(s.highlight, id)
+		}
+	}
+}
+
+// highlightOf returns the current highlight of sprite info. Sprites that
+// have not been updated yet start at their target.
+func (s *Stage) highlightOf(info script.SpriteInfo) float64 {
+	if h, ok := s.highlight[info.ID]; ok {
+		return h
+	}
+	return s.highlightTarget(info)
+}
+
+// prune drops sprites that have finished fading out, forgets the previous
+// image of finished crossfades and drops finished motions.
+func (s *Stage) prune() {
+	tracks := s.tracks[:0]
+	for _, t := range s.tracks {
+		t.motions = pruneMotions(t.motions)
+		if t.done() {
+			if t.leaving {
+				continue
+			}
+			t.hasPrev = false
+		}
+		tracks = append(tracks, t)
+	}
+	s.tracks = tracks
+	s.screen = pruneMotions(s.screen)
+}
+
+func pruneMotions(motions []*motion) []*motion {
+	out := motions[:0]
+	for _, m := range motions {
+		if !m.tween.Done() {
+			out = append(out, m)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// State returns the persistent state of the stage.
+func (s *Stage) State() StageState {
+	state := StageState{
+		BG:         s.bg,
+		Effects:    s.effects,
+		Camera:     s.camera,
+		Particles:  s.particles,
+		Foreground: s.foreground.file,
+		CG:         s.cg.file,
+		Overlay:    s.overlay.file,
+	}
+	for _, t := range s.tracks {
+		if !t.leaving {
+			state.Sprites = append(state.Sprites, t.info)
+		}
+	}
+	return state
+}
+
+// Restore replaces the stage with state immediately, without transitions.
+// Animated images start over.
+func (s *Stage) Restore(state StageState) {
+	clock := s.clock
+	*s = Stage{
+		bg:         state.BG,
+		bgEasing:   anim.Linear,
+		bgStart:    clock,
+		effects:    state.Effects,
+		camera:     state.Camera,
+		particles:  state.Particles,
+		foreground: plane{file: state.Foreground, start: clock},
+		cg:         plane{file: state.CG, start: clock},
+		overlay:    plane{file: state.Overlay, start: clock},
+		clock:      clock,
+	}
+	for _, info := range state.Sprites {
+		s.tracks = append(s.tracks, &spriteTrack{info: info, easing: anim.Linear, shown: clock})
+	}
+}
+
+// SetBackground switches the background immediately without a transition.
+func (s *Stage) SetBackground(file string) {
+	s.prevBG = ""
+	s.bg = file
+	s.bgStart = s.clock
+	s.bgFade = 0
+	s.bgElapsed = 0
+}
+
+// FinishTransitions jumps every running transition and motion, but not
+// camera moves, to its end state.
+func (s *Stage) FinishTransitions() {
+	s.bgElapsed = s.bgFade
+	for _, t := range s.tracks {
+		t.elapsed = t.fade
+		for _, m := range t.motions {
+			m.tween.Finish()
+		}
+	}
+	for _, m := range s.screen {
+		m.tween.Finish()
+	}
+	s.effectFade.Finish()
+	s.flashFade.Finish()
+	for _, p := range s.planes() {
+		p.fade.Finish()
+	}
+	s.prune()
+}
+
+// Transitioning reports whether any transition or motion is still running.
+// Camera moves are left out: they run behind the dialogue, so slow drifts
+// neither hold up clicks nor are cut short by them.
+func (s *Stage) Transitioning() bool {
+	if s.bgElapsed < s.bgFade || len(s.screen) > 0 || !s.effectFade.Done() || !s.flashFade.Done() {
+		return true
+	}
+	for _, p := range s.planes() {
+		if !p.fade.Done() {
+			return true
+		}
+	}
+	for _, t := range s.tracks {
+		if !t.done() || len(t.motions) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot returns the current state for drawing.
+func (s *Stage) Snapshot() StageSnapshot {
+	snap := StageSnapshot{
+		BG:         s.bg,
+		BGProgress: 1,
+		BGStart:    s.bgStart,
+		Screen:     screenMotion(s.screen),
+		Effects:    blendEffects(s.prevEffects, s.effects, s.effectFade.Value()),
+
+		CameraFrom:     s.prevCamera,
+		Camera:         s.camera,
+		CameraProgress: s.cameraMove.Value(),
+		Clock:          s.clock,
+
+		Foreground: s.foreground.snapshot(),
+		CG:         s.cg.snapshot(),
+		Overlay:    s.overlay.snapshot(),
+	}
+	if !s.flashFade.Done() {
+		snap.Flash = s.flash
+		snap.FlashAlpha = 1 - s.flashFade.Value()
+	}
+	if s.bgElapsed < s.bgFade {
+		snap.PrevBG = s.prevBG
+		snap.PrevBGStart = s.prevBGStart
+		snap.BGTransition = s.bgTrans
+		snap.BGProgress = s.bgEasing(anim.Progress(s.bgElapsed, s.bgFade))
+	}
+	for _, t := range s.tracks {
+		mo := spriteMotion(t.info, t.motions)
+		hl := s.highlightOf(t.info)
+		layer := func(info script.SpriteInfo, alpha float64, start time.Duration) SpriteLayer {
+			return SpriteLayer{Info: info, Alpha: alpha, Motion: mo, Highlight: hl, Start: start}
+		}
+		if t.done() {
+			snap.Sprites = append(snap.Sprites, layer(t.info, 1, t.shown))
+			continue
+		}
+		p := t.easing(anim.Progress(t.elapsed, t.fade))
+		switch {
+		case t.leaving:
+			snap.Sprites = append(snap.Sprites, layer(t.info, 1-p, t.shown))
+		case t.hasPrev:
+			snap.Sprites = append(snap.Sprites, layer(t.prev, 1-p, t.prevShown), layer(t.info, p, t.shown))
+		default:
+			snap.Sprites = append(snap.Sprites, layer(t.info, p, t.shown))
+		}
+	}
+	sortByZ(snap.Sprites)
+	return snap
+}
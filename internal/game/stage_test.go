@@ -0,0 +1,295 @@
+//go:build headless
+// +build headless
+
+package game
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"novegido/internal/script"
+)
+
+func TestStageInstantChange(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{BG: "a.png"})
+	snap := s.Snapshot()
+	if snap.BG != "a.png" || snap.BGProgress != 1 || snap.PrevBG != "" {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+}
+
+func TestStageFadeAdvancesByTime(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{BG: "a.png"})
+	s.Apply(&script.StageInfo{BG: "b.png", BGFadeMs: 100})
+	s.Update(50 * time.Millisecond)
+	snap := s.Snapshot()
+	if snap.PrevBG != "a.png" || snap.BG != "b.png" {
+		t.Fatalf("unexpected backgrounds: %+v", snap)
+	}
+	if snap.BGProgress != 0.5 {
+		t.Fatalf("BGProgress = %v, want 0.5", snap.BGProgress)
+	}
+	s.Update(50 * time.Millisecond)
+	if snap := s.Snapshot(); snap.BGProgress != 1 || snap.PrevBG != "" {
+		t.Fatalf("fade should be finished: %+v", snap)
+	}
+}
+
+func TestStageSnapshotIsReadOnly(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{BG: "a.png"})
+	s.Apply(&script.StageInfo{BG: "b.png", BGFadeMs: 100})
+	s.Update(10 * time.Millisecond)
+	first := s.Snapshot()
+	for i := 0; i < 5; i++ {
+		if got := s.Snapshot(); got.BGProgress != first.BGProgress {
+			t.Fatalf("snapshot changed without Update: %v != %v", got.BGProgress, first.BGProgress)
+		}
+	}
+}
+
+func TestStageFinishTransitions(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{
+		BG:         "a.png",
+		BGFadeMs:   1000,
+		Sprites:    []script.SpriteInfo{{ID: "k", File: "k.png", Pos: "left"}},
+		SpriteFade: 60,
+	})
+	if !s.Transitioning() {
+		t.Fatal("expected transitions to be running")
+	}
+	s.FinishTransitions()
+	if s.Transitioning() {
+		t.Fatal("transitions should be finished")
+	}
+	snap := s.Snapshot()
+	if snap.BGProgress != 1 || len(snap.Sprites) != 1 || snap.Sprites[0].Alpha != 1 {
+		t.Fatalf("unexpected snapshot after finish: %+v", snap)
+	}
+}
+
+func TestStageNilInfoKeepsState(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{BG: "a.png", Sprites: []script.SpriteInfo{{ID: "k", File: "k.png"}}})
+	s.Apply(nil)
+	s.Apply(&script.StageInfo{BG: "a.png"})
+	snap := s.Snapshot()
+	if snap.BG != "a.png" || len(snap.Sprites) != 1 {
+		t.Fatalf("stage should persist between pages: %+v", snap)
+	}
+}
+
+func TestStageRestore(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{BG: "a.png"})
+	saved := s.State()
+	s.Apply(&script.StageInfo{BG: "b.png", BGFadeMs: 100})
+	s.Restore(saved)
+	if snap := s.Snapshot(); snap.BG != "a.png" || snap.BGProgress != 1 {
+		t.Fatalf("restore should be instant: %+v", snap)
+	}
+}
+
+func TestApplyStageOperations(t *testing.T) {
+	kuro := script.SpriteInfo{ID: "kuro", Expr: "joy", Pos: "right"}
+	siro := script.SpriteInfo{ID: "siro", Expr: "neutral", Pos: "left"}
+	base := StageState{BG: "room.jpg", Sprites: []script.SpriteInfo{kuro}}
+
+	tests := []struct {
+		name string
+		st   *script.StageInfo
+		want []script.SpriteInfo
+	}{
+		{"show adds", &script.StageInfo{Show: []script.SpriteInfo{siro}}, []script.SpriteInfo{kuro, siro}},
+		{"show updates", &script.StageInfo{Show: []script.SpriteInfo{{ID: "kuro", Pos: "center"}}},
+			[]script.SpriteInfo{{ID: "kuro", Expr: "joy", Pos: "center"}}},
+		{"hide", &script.StageInfo{Hide: []string{"kuro"}}, []script.SpriteInfo{}},
+		{"expr", &script.StageInfo{Expr: map[string]string{"kuro": "wink"}},
+			[]script.SpriteInfo{{ID: "kuro", Expr: "wink", Pos: "right"}}},
+		{"move", &script.StageInfo{Move: map[string]string{"kuro": "left"}},
+			[]script.SpriteInfo{{ID: "kuro", Expr: "joy", Pos: "left"}}},
+		{"replace", &script.StageInfo{Sprites: []script.SpriteInfo{siro}}, []script.SpriteInfo{siro}},
+		{"replace then show", &script.StageInfo{Sprites: []script.SpriteInfo{}, Show: []script.SpriteInfo{siro}},
+			[]script.SpriteInfo{siro}},
+		{"unknown ids ignored", &script.StageInfo{Hide: []string{"x"}, Move: map[string]string{"x": "left"}},
+			[]script.SpriteInfo{kuro}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := applyStage(base, tt.st)
+			if got.BG != "room.jpg" {
+				t.Errorf("background changed: %q", got.BG)
+			}
+			if !reflect.DeepEqual(got.Sprites, tt.want) {
+				t.Errorf("sprites = %+v, want %+v", got.Sprites, tt.want)
+			}
+		})
+	}
+	if !reflect.DeepEqual(base.Sprites, []script.SpriteInfo{kuro}) {
+		t.Fatalf("applyStage modified its input: %+v", base.Sprites)
+	}
+}
+
+func TestApplyStageExprKeepsReference(t *testing.T) {
+	base := StageState{Sprites: []script.SpriteInfo{{ID: "k", File: "kuro:joy"}}}
+	got := applyStage(base, &script.StageInfo{Expr: map[string]string{"k": "wink"}})
+	if f := got.Sprites[0].File; f != "kuro:wink" {
+		t.Fatalf("File = %q, want kuro:wink", f)
+	}
+}
+
+// layers summarises a snapshot as "id/expr" to alpha for comparison.
+func layers(snap StageSnapshot) map[string]float64 {
+	out := map[string]float64{}
+	for _, l := range snap.Sprites {
+		out[l.Info.ID+"/"+l.Info.Expr] = l.Alpha
+	}
+	return out
+}
+
+func TestStagePerSpriteTransitions(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{Sprites: []script.SpriteInfo{
+		{ID: "kuro", Expr: "joy", Pos: "right"},
+		{ID: "siro", Expr: "neutral", Pos: "left"},
+		{ID: "mob", Expr: "a", Pos: "center"},
+	}})
+	s.Apply(&script.StageInfo{
+		SpriteFadeMs: 100,
+		Expr:         map[string]string{"kuro": "wink"},
+		Hide:         []string{"mob"},
+		Show:         []script.SpriteInfo{{ID: "new", Expr: "x", FadeMs: 200}},
+	})
+	s.Update(50 * time.Millisecond)
+	want := map[string]float64{
+		"kuro/joy":     0.5,
+		"kuro/wink":    0.5,
+		"siro/neutral": 1,
+		"mob/a":        0.5,
+		"new/x":        0.25,
+	}
+	if got := layers(s.Snapshot()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("layers = %v, want %v", got, want)
+	}
+
+	s.Update(50 * time.Millisecond)
+	want = map[string]float64{
+		"kuro/wink":    1,
+		"siro/neutral": 1,
+		"new/x":        0.5,
+	}
+	if got := layers(s.Snapshot()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("layers = %v, want %v", got, want)
+	}
+	if !s.Transitioning() {
+		t.Fatal("the slower sprite should still be fading in")
+	}
+}
+
+func TestStageMoveIsNotAFade(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{Show: []script.SpriteInfo{{ID: "kuro", Expr: "joy", Pos: "right"}}})
+	s.Apply(&script.StageInfo{SpriteFadeMs: 100, Move: map[string]string{"kuro": "left"}})
+	snap := s.Snapshot()
+	if len(snap.Sprites) != 1 || snap.Sprites[0].Alpha != 1 || snap.Sprites[0].Info.Pos != "left" {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+}
+
+func TestStageReshowWhileLeaving(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{Show: []script.SpriteInfo{{ID: "kuro", Expr: "joy"}}})
+	s.Apply(&script.StageInfo{SpriteFadeMs: 100, Hide: []string{"kuro"}})
+	s.Apply(&script.StageInfo{Show: []script.SpriteInfo{{ID: "kuro", Expr: "joy"}}})
+	if got := s.State().Sprites; len(got) != 1 {
+		t.Fatalf("state sprites = %+v", got)
+	}
+	if got := layers(s.Snapshot()); len(got) != 1 || got["kuro/joy"] != 1 {
+		t.Fatalf("layers = %v", got)
+	}
+}
+
+func TestStageBGTransition(t *testing.T) {
+	s := NewStage()
+	s.Apply(&script.StageInfo{BG: "a.png"})
+	wipe := &script.TransitionInfo{Type: "wipe", Direction: "left", Softness: 0.1}
+	s.Apply(&script.StageInfo{BG: "b.png", BGFadeMs: 100, Transition: wipe})
+	if got := s.Snapshot().BGTransition; got != *wipe {
+		t.Fatalf("BGTransition = %+v, want %+v", got, *wipe)
+	}
+	s.Update(100 * time.Millisecond)
+	if got := s.Snapshot().BGTransition; got != (script.TransitionInfo{}) {
+		t.Fatalf("finished transition should be cleared: %+v", got)
+	}
+	s.Apply(&script.StageInfo{BG: "c.png", BGFadeMs: 100})
+	if got := s.Snapshot().BGTransition.Type; got != "" {
+		t.Fatalf("page without a transition should crossfade, got %q", got)
+	}
+}
+
+func TestApplyStageLayers(t *testing.T) {
+	base := StageState{Sprites: []script.SpriteInfo{{ID: "k", Layers: map[string]string{"outfit": "school"}}}}
+	got := applyStage(base, &script.StageInfo{Layers: map[string]map[string]string{"k": {"accessory": "ribbon"}}})
+	want := map[string]string{"outfit": "school", "accessory": "ribbon"}
+	if !reflect.DeepEqual(got.Sprites[0].Layers, want) {
+		t.Fatalf("layers = %v, want %v", got.Sprites[0].Layers, want)
+	}
+	if len(base.Sprites[0].Layers) != 1 {
+		t.Fatalf("applyStage modified its input: %v", base.Sprites[0].Layers)
+	}
+	got = applyStage(got, &script.StageInfo{Show: []script.SpriteInfo{{ID: "k", Expr: "joy"}}})
+	if !reflect.DeepEqual(got.Sprites[0].Layers, want) {
+		t.Fatalf("show without layers should keep them: %v", got.Sprites[0].Layers)
+	}
+
+	s := NewStage()
+	s.Restore(base)
+	s.Apply(&script.StageInfo{SpriteFadeMs: 100, Layers: map[string]map[string]string{"k": {"outfit": "winter"}}})
+	if n := len(s.Snapshot().Sprites); n != 2 {
+		t.Fatalf("changing a layer should crossfade, got %d layers", n)
+	}
+}
+
+func TestStageClock(t *testing.T) {
+	s := NewStage()
+	s.Update(30 * time.Millisecond)
+	s.Update(20 * time.Millisecond)
+	if got := s.Snapshot().Clock; got != 50*time.Millisecond {
+		t.Fatalf("Clock = %v, want 50ms", got)
+	}
+	s.Restore(StageState{BG: "a.png"})
+	if got := s.Snapshot().Clock; got != 50*time.Millisecond {
+		t.Fatalf("restoring should not rewind animations, Clock = %v", got)
+	}
+}
+
+func TestStageImageStarts(t *testing.T) {
+	s := NewStage()
+	s.Update(time.Second)
+	s.Apply(&script.StageInfo{
+		BG:         "a.png",
+		Show:       []script.SpriteInfo{{ID: "k", Expr: "a"}},
+		Foreground: &script.LayerInfo{File: "rain.png"},
+	})
+	s.Update(time.Second)
+	s.Apply(&script.StageInfo{BGFade: 500, SpriteFadeMs: 500, Expr: map[string]string{"k": "b"}, BG: "b.png"})
+	snap := s.Snapshot()
+	if snap.PrevBGStart != time.Second || snap.BGStart != 2*time.Second {
+		t.Fatalf("background starts = %v, %v", snap.PrevBGStart, snap.BGStart)
+	}
+	if len(snap.Sprites) != 2 || snap.Sprites[0].Start != time.Second || snap.Sprites[1].Start != 2*time.Second {
+		t.Fatalf("sprite layers = %+v", snap.Sprites)
+	}
+	if snap.Foreground.Start != time.Second {
+		t.Fatalf("unchanged layer should keep its start, got %v", snap.Foreground.Start)
+	}
+	s.Update(time.Second)
+	s.Restore(s.State())
+	if snap := s.Snapshot(); snap.BGStart != 3*time.Second || snap.Sprites[0].Start != 3*time.Second {
+		t.Fatalf("restoring should start animations over, got %v, %v", snap.BGStart, snap.Sprites[0].Start)
+	}
+}
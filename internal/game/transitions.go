@@ -0,0 +1,183 @@
+//go:build !headless
+// +build !headless
+
+package game
+
+import (
+	"image"
+	"image/color"
+	"log"
+	"path/filepath"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+	"novegido/internal/character"
+	"novegido/internal/script"
+	"novegido/internal/transition"
+)
+
+// defaultPixelBlock is the largest block of a pixelate transition when the
+// script gives none.
+const defaultPixelBlock = 32
+
+// drawImageFunc draws one image of a background or layer at alpha, displaced
+// by (dx, dy). An empty file is what the layer shows without an image.
+type drawImageFunc func(dst *ebiten.Image, file string, alpha, dx, dy float64)
+
+// drawTransition draws a change from the image prev to next in progress p,
+// drawing each image with draw. Opaque images, such as backgrounds, cover
+// the whole screen; layers are drawn over what lies beneath them.
+func (r *StageRenderer) drawTransition(dst *ebiten.Image, prev, next string, p float64, tr script.TransitionInfo, opaque bool, draw drawImageFunc) {
+	switch tr.Type {
+	case transition.Wipe:
+		r.drawMasked(dst, prev, next, p, tr.Softness, opaque, draw, r.order("wipe:"+tr.Direction, func() []float64 {
+			return transition.Ramp(r.screenW, r.screenH, tr.Direction)
+		}))
+	case transition.Iris:
+		r.drawMasked(dst, prev, next, p, tr.Softness, opaque, draw, r.order("iris", func() []float64 {
+			return transition.IrisOrder(r.screenW, r.screenH)
+		}))
+	case transition.Rule:
+		r.drawMasked(dst, prev, next, p, tr.Softness, opaque, draw, r.order("rule:"+tr.Rule, func() []float64 {
+			return r.ruleOrder(tr.Rule)
+		}))
+	case transition.Slide, transition.Push:
+		// A layer always pushes: left in place, the old image would show
+		// through wherever the new one is clear.
+		dx, dy := transition.SlideOffset(tr.Direction, p, r.screenW, r.screenH)
+		if tr.Type == transition.Push || !opaque {
+			ox, oy := transition.SlideOffset(tr.Direction, 0, r.screenW, r.screenH)
+			draw(dst, prev, 1, dx-ox, dy-oy)
+		} else {
+			draw(dst, prev, 1, 0, 0)
+		}
+		draw(dst, next, 1, dx, dy)
+	case transition.Pixelate:
+		block := tr.Block
+		if block <= 0 {
+			block = defaultPixelBlock
+		}
+		size, incoming := transition.PixelBlock(p, block)
+		file := prev
+		if incoming {
+			file = next
+		}
+		r.drawPixelated(dst, file, size, draw)
+	case transition.Dissolve:
+		// A layer dissolves through nothing rather than the colour, which
+		// would blank the stage beneath it.
+		if opaque {
+			c := color.RGBA{A: 255}
+			if tr.Color != "" {
+				var err error
+				if c, err = character.ParseColor(tr.Color); err != nil {
+					log.Printf("transition color: %v", err)
+				}
+			}
+			dst.Fill(c)
+		}
+		oldA, newA := transition.ThroughColor(p)
+		draw(dst, prev, oldA, 0, 0)
+		draw(dst, next, newA, 0, 0)
+	default:
+		if opaque {
+			draw(dst, prev, 1-p, 0, 0)
+			draw(dst, next, p, 0, 0)
+			return
+		}
+		r.layer.Clear()
+		r.addToLayer(prev, 1-p, false, draw)
+		r.addToLayer(next, p, false, draw)
+		dst.DrawImage(r.layer, nil)
+	}
+}
+
+// drawMasked draws the new image through the alpha mask that order gives at
+// progress p. An opaque old image is drawn whole beneath it; the old image
+// of a layer is hidden through the inverse mask instead, so that the stage
+// beneath shows where neither image is left.
+func (r *StageRenderer) drawMasked(dst *ebiten.Image, prev, next string, p, softness float64, opaque bool, draw drawImageFunc, order []float64) {
+	if opaque {
+		draw(dst, prev, 1, 0, 0)
+		transition.Mask(r.maskPix, order, p, softness)
+		r.mask.WritePixels(r.maskPix)
+		r.drawThroughMask(dst, next, draw, ebiten.BlendSourceOver)
+		return
+	}
+	r.layer.Clear()
+	transition.InverseMask(r.maskPix, order, p, softness)
+	r.mask.WritePixels(r.maskPix)
+	r.addToLayer(prev, 1, true, draw)
+	transition.Mask(r.maskPix, order, p, softness)
+	r.mask.WritePixels(r.maskPix)
+	r.addToLayer(next, 1, true, draw)
+	dst.DrawImage(r.layer, nil)
+}
+
+// addToLayer adds file at alpha to r.layer, through r.mask when masked.
+// Adding the two images of a layer transition, each weighted by its share,
+// blends them without either darkening the other where both are partly
+// shown.
+func (r *StageRenderer) addToLayer(file string, alpha float64, masked bool, draw drawImageFunc) {
+	if file == "" || alpha <= 0 {
+		return
+	}
+	if !masked {
+		r.scratch.Clear()
+		draw(r.scratch, file, alpha, 0, 0)
+		r.layer.DrawImage(r.scratch, &ebiten.DrawImageOptions{Blend: ebiten.BlendLighter})
+		return
+	}
+	r.drawThroughMask(r.layer, file, draw, ebiten.BlendLighter)
+}
+
+// drawThroughMask draws file onto dst through r.mask with blend.
+func (r *StageRenderer) drawThroughMask(dst *ebiten.Image, file string, draw drawImageFunc, blend ebiten.Blend) {
+	r.scratch.Clear()
+	draw(r.scratch, file, 1, 0, 0)
+	op := &ebiten.DrawImageOptions{}
+	op.Blend = ebiten.BlendDestinationIn
+	r.scratch.DrawImage(r.mask, op)
+	dst.DrawImage(r.scratch, &ebiten.DrawImageOptions{Blend: blend})
+}
+
+// drawPixelated draws an image in blocks of size pixels.
+func (r *StageRenderer) drawPixelated(dst *ebiten.Image, file string, size int, draw drawImageFunc) {
+	if size <= 1 {
+		draw(dst, file, 1, 0, 0)
+		return
+	}
+	r.scratch.Clear()
+	draw(r.scratch, file, 1, 0, 0)
+	w := (r.screenW + size - 1) / size
+	h := (r.screenH + size - 1) / size
+	r.mask.Clear()
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(1/float64(size), 1/float64(size))
+	r.mask.DrawImage(r.scratch, op)
+	op = &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(size), float64(size))
+	dst.DrawImage(r.mask.SubImage(image.Rect(0, 0, w, h)).(*ebiten.Image), op)
+}
+
+// order returns the cached reveal order for key, building it on first use.
+func (r *StageRenderer) order(key string, build func() []float64) []float64 {
+	if o, ok := r.orders[key]; ok {
+		return o
+	}
+	o := build()
+	r.orders[key] = o
+	return o
+}
+
+// ruleOrder reads a rule image from assets/rules, falling back to a wipe to
+// the right when it cannot be loaded.
+func (r *StageRenderer) ruleOrder(file string) []float64 {
+	_, img, err := ebitenutil.NewImageFromFile(filepath.Join("assets", "rules", file))
+	if err != nil {
+		log.Printf("rule image load error: %v", err)
+		return transition.Ramp(r.screenW, r.screenH, transition.Right)
+	}
+	return transition.FromImage(img, r.screenW, r.screenH)
+}
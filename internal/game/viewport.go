@@ -0,0 +1,27 @@
+package game
+
+// viewport describes where the logical canvas lands inside the window.
+type viewport struct {
+	Scale float64
+	X, Y  float64
+}
+
+// fitViewport scales a logical canvas of lw×lh uniformly so that it fits an
+// output of ow×oh and centres it, leaving letterbox or pillarbox bars on the
+// remaining sides.
+func fitViewport(lw, lh, ow, oh int) viewport {
+	if lw <= 0 || lh <= 0 || ow <= 0 || oh <= 0 {
+		return viewport{Scale: 1}
+	}
+	sx := float64(ow) / float64(lw)
+	sy := float64(oh) / float64(lh)
+	s := sx
+	if sy < s {
+		s = sy
+	}
+	return viewport{
+		Scale: s,
+		X:     (float64(ow) - float64(lw)*s) / 2,
+		Y:     (float64(oh) - float64(lh)*s) / 2,
+	}
+}
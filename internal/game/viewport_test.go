@@ -0,0 +1,27 @@
+//go:build headless
+// +build headless
+
+package game
+
+import "testing"
+
+func TestFitViewport(t *testing.T) {
+	tests := []struct {
+		name           string
+		lw, lh, ow, oh int
+		want           viewport
+	}{
+		{"exact", 640, 480, 640, 480, viewport{1, 0, 0}},
+		{"hidpi", 640, 480, 1280, 960, viewport{2, 0, 0}},
+		{"pillarbox", 640, 480, 1920, 1080, viewport{2.25, 240, 0}},
+		{"letterbox", 640, 480, 640, 600, viewport{1, 0, 60}},
+		{"empty", 640, 480, 0, 0, viewport{Scale: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fitViewport(tt.lw, tt.lh, tt.ow, tt.oh); got != tt.want {
+				t.Errorf("fitViewport = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
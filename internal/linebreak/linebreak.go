@@ -0,0 +1,135 @@
+// Package linebreak decides where text may be broken into lines. Japanese
+// text follows kinsoku shori, which forbids certain characters at the start
+// or end of a line; other text uses a simplified form of the Unicode line
+// breaking algorithm (UAX #14), breaking after spaces and hyphens.
+package linebreak
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MeasureFunc reports the advance width of a string in pixels.
+type MeasureFunc func(s string) float64
+
+// Options adjusts how Wrap breaks lines.
+type Options struct {
+	// Hanging lets a comma or full stop that would start the next line hang
+	// past the right edge of the current one instead of pulling the
+	// preceding character down with it (burasage).
+	Hanging bool
+}
+
+// noStart lists characters that must not begin a line (gyoutou kinsoku).
+const noStart = "、。，．,.)]}）］｝〕〉》」』】〙〗〟’”｠»" +
+	"ー‐゠–〜～・：；:;!?！？‼⁇⁈⁉…‥" +
+	"ヽヾゝゞ々〻" +
+	"ぁぃぅぇぉっゃゅょゎゕゖァィゥェォッャュョヮヵヶㇰㇱㇲㇳㇴㇵㇶㇷㇸㇹㇺㇻㇼㇽㇾㇿ"
+
+// noEnd lists characters that must not end a line (gyoumatsu kinsoku).
+const noEnd = "([{（［｛〔〈《「『【〘〖〝‘“｟«"
+
+// hangable lists punctuation that may hang outside the line when
+// Options.Hanging is set.
+const hangable = "、。，．,."
+
+// CanStartLine reports whether r may appear at the start of a line.
+func CanStartLine(r rune) bool { return !strings.ContainsRune(noStart, r) }
+
+// CanEndLine reports whether r may appear at the end of a line.
+func CanEndLine(r rune) bool { return !strings.ContainsRune(noEnd, r) }
+
+// Opportunities reports, for each rune of s, whether a line may be broken
+// immediately before it. The first entry is always false.
+func Opportunities(s []rune) []bool {
+	ops := make([]bool, len(s))
+	for i := 1; i < len(s); i++ {
+		ops[i] = breakBetween(s[i-1], s[i])
+	}
+	return ops
+}
+
+func breakBetween(a, b rune) bool {
+	if b == ' ' || !CanStartLine(b) || !CanEndLine(a) {
+		return false
+	}
+	if a == ' ' {
+		return true
+	}
+	if IsWide(a) || IsWide(b) {
+		return true
+	}
+	if a == '-' && unicode.IsLetter(b) {
+		return true
+	}
+	return false
+}
+
+// IsWide reports whether r belongs to a script written without spaces, where
+// a break is allowed between any two characters.
+func IsWide(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) ||
+		(r >= 0x3000 && r <= 0x30FF) ||
+		(r >= 0xFF00 && r <= 0xFFEF)
+}
+
+// Wrap breaks s into lines no wider than width according to measure. Explicit
+// newlines always start a new line. When no legal break exists within the
+// width the line is broken at the last character that fits.
+func Wrap(s string, width float64, measure MeasureFunc, opts Options) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		lines = append(lines, wrapParagraph([]rune(para), width, measure, opts)...)
+	}
+	return lines
+}
+
+func wrapParagraph(rs []rune, width float64, measure MeasureFunc, opts Options) []string {
+	ops := Opportunities(rs)
+	var lines []string
+	start := 0
+	for start < len(rs) && rs[start] == ' ' {
+		start++
+	}
+	lastBreak := -1
+	for i := start; i < len(rs); i++ {
+		if i > start && ops[i] {
+			lastBreak = i
+		}
+		if measure(trimRight(rs[start:i+1])) <= width {
+			continue
+		}
+		if i == start {
+			// A single character wider than the line still has to go
+			// somewhere.
+			continue
+		}
+		var end int
+		switch {
+		case opts.Hanging && strings.ContainsRune(hangable, rs[i]):
+			end = i + 1
+		case lastBreak > start:
+			end = lastBreak
+		default:
+			end = i
+		}
+		lines = append(lines, trimRight(rs[start:end]))
+		start = end
+		for start < len(rs) && rs[start] == ' ' {
+			start++
+		}
+		lastBreak = -1
+		i = start - 1
+	}
+	if start < len(rs) || len(lines) == 0 {
+		lines = append(lines, trimRight(rs[start:]))
+	}
+	return lines
+}
+
+func trimRight(rs []rune) string {
+	return strings.TrimRight(string(rs), " ")
+}
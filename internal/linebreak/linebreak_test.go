@@ -0,0 +1,74 @@
+//go:build headless
+// +build headless
+
+package linebreak
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+// monospace measures every rune as 10 pixels wide.
+func monospace(s string) float64 { return float64(utf8.RuneCountInString(s) * 10) }
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		width float64
+		opts  Options
+		want  []string
+	}{
+		{"fits", "hello", 100, Options{}, []string{"hello"}},
+		{"latin", "the quick brown fox", 100, Options{}, []string{"the quick", "brown fox"}},
+		{"hyphen", "well-known", 60, Options{}, []string{"well-", "known"}},
+		{"long word", "abcdefghijkl", 50, Options{}, []string{"abcde", "fghij", "kl"}},
+		{"cjk", "おはようございます", 40, Options{}, []string{"おはよう", "ございま", "す"}},
+		{"mixed", "クロ says hi", 60, Options{}, []string{"クロ", "says", "hi"}},
+		{"newline", "a\nb", 100, Options{}, []string{"a", "b"}},
+		{"empty", "", 100, Options{}, []string{""}},
+		// 。 may not start a line, so ね moves down with it.
+		{"no start period", "そうですね。", 50, Options{}, []string{"そうです", "ね。"}},
+		// With hanging punctuation the 。 stays on the first line.
+		{"hanging", "そうですね。", 50, Options{Hanging: true}, []string{"そうですね。"}},
+		// Small kana stay with the preceding character.
+		{"small kana", "ちょっと", 20, Options{}, []string{"ちょ", "っと"}},
+		// An opening bracket may not end a line.
+		{"no end bracket", "あいう「えお」", 40, Options{}, []string{"あいう", "「えお」"}},
+		// A closing bracket stays on the line of the text it closes.
+		{"closing", "あい」うえ", 20, Options{}, []string{"あ", "い」", "うえ"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Wrap(tt.input, tt.width, monospace, tt.opts)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Wrap(%q, %v) = %q, want %q", tt.input, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpportunities(t *testing.T) {
+	got := Opportunities([]rune("「あ」 go"))
+	want := []bool{false, false, false, false, true, false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Opportunities = %v, want %v", got, want)
+	}
+}
+
+func TestKinsokuSets(t *testing.T) {
+	for _, r := range "、。」』）ーっャ" {
+		if CanStartLine(r) {
+			t.Errorf("%q should not start a line", r)
+		}
+	}
+	for _, r := range "「『（" {
+		if CanEndLine(r) {
+			t.Errorf("%q should not end a line", r)
+		}
+	}
+	if !CanStartLine('あ') || !CanEndLine('あ') {
+		t.Error("plain kana should be allowed anywhere")
+	}
+}
@@ -0,0 +1,145 @@
+// Package project loads settings that are declared once per game rather than
+// per script, such as the logical screen resolution.
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+
+	"novegido/internal/script"
+)
+
+// Position is a named sprite placement preset. The sprite's anchor point,
+// given as fractions of its width and height, is placed at (X, Y).
+type Position struct {
+	X      script.Coord `json:"x"`
+	Y      script.Coord `json:"y"`
+	Anchor [2]float64   `json:"anchor"`
+}
+
+// Fit modes say how a background image is fitted to the screen: stretched
+// to fill it exactly, scaled to cover it and cropped, scaled to fit inside
+// it, or centred at its own size.
+const (
+	FitStretch = "stretch"
+	FitCover   = "cover"
+	FitContain = "contain"
+	FitCenter  = "center"
+)
+
+// Background holds how background images are fitted. Color fills whatever
+// a contained or centred image leaves uncovered.
+type Background struct {
+	Fit   string `json:"fit,omitempty"`
+	Color string `json:"color,omitempty"`
+}
+
+// Highlight makes the speaking character stand out. Other sprites are
+// darkened by Dim and lose Desaturate of their colour, both fractions from 0
+// to 1. Front draws the speaker above sprites of the same z-order and Bob
+// moves it up and down by that many pixels while it talks. Changes of
+// speaker fade over FadeMs.
+type Highlight struct {
+	Enabled    bool    `json:"enabled"`
+	Dim        float64 `json:"dim"`
+	Desaturate float64 `json:"desaturate"`
+	Front      bool    `json:"front"`
+	Bob        float64 `json:"bob"`
+	FadeMs     int     `json:"fadeMs"`
+}
+
+// Config holds project-wide settings.
+type Config struct {
+	Title  string `json:"title"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// HangingPunctuation lets 、 and 。 hang past the right edge of a line
+	// instead of being carried over with the preceding character.
+	HangingPunctuation bool `json:"hangingPunctuation,omitempty"`
+	// Language selects which localized character names are shown.
+	Language string `json:"language"`
+	// Characters is the path of the character registry.
+	Characters string `json:"characters"`
+	// Particles is the path of the particle emitter settings.
+	Particles string `json:"particles"`
+	// Positions holds sprite position presets by name. Presets in the
+	// project file are added to, or replace, the defaults.
+	Positions map[string]Position `json:"positions"`
+	// Background is the fit used for every background image and
+	// Backgrounds overrides it for individual files.
+	Background  Background            `json:"background"`
+	Backgrounds map[string]Background `json:"backgrounds,omitempty"`
+	// Highlight is off unless the project enables it.
+	Highlight Highlight `json:"highlight"`
+}
+
+// BackgroundFor returns the fit of the background image file.
+func (c *Config) BackgroundFor(file string) Background {
+	b := c.Background
+	if o, ok := c.Backgrounds[file]; ok {
+		if o.Fit != "" {
+			b.Fit = o.Fit
+		}
+		if o.Color != "" {
+			b.Color = o.Color
+		}
+	}
+	return b
+}
+
+// PositionNames returns the names of all position presets in sorted order.
+func (c *Config) PositionNames() []string {
+	names := make([]string, 0, len(c.Positions))
+	for n := range c.Positions {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func bottomAt(pct float64) Position {
+	return Position{X: script.Pct(pct), Y: script.Pct(100), Anchor: [2]float64{0.5, 1}}
+}
+
+// Default returns the settings used when no project file is present.
+func Default() *Config {
+	return &Config{
+		Title:      "Novel Game Demo",
+		Width:      640,
+		Height:     480,
+		Language:   "ja",
+		Characters: "assets/characters.json",
+		Particles:  "assets/particles.json",
+		Positions: map[string]Position{
+			"left":   bottomAt(20),
+			"center": bottomAt(50),
+			"right":  bottomAt(80),
+		},
+		Background: Background{Fit: FitStretch, Color: "#000000"},
+		Highlight:  Highlight{Dim: 0.4, FadeMs: 200},
+	}
+}
+
+// Load reads a project file. Missing fields keep their default values and a
+// missing file yields the defaults without an error.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, errors.New("project: width and height must be positive")
+	}
+	return cfg, nil
+}
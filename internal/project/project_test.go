@@ -0,0 +1,85 @@
+//go:build headless
+// +build headless
+
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"novegido/internal/script"
+)
+
+func TestLoadMissingFileUsesDefaults(t *testing.T) {
+	cfg, err := Load(filepath.Join(t.TempDir(), "none.json"))
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Fatalf("got %+v, want defaults", cfg)
+	}
+}
+
+func TestLoadOverridesDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "project.json")
+	if err := os.WriteFile(path, []byte(`{"width":1280,"height":720}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if cfg.Width != 1280 || cfg.Height != 720 || cfg.Title != Default().Title {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
+
+func TestLoadRejectsBadSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "project.json")
+	if err := os.WriteFile(path, []byte(`{"width":0}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for zero width")
+	}
+}
+
+func TestLoadPositionsMergeWithDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "project.json")
+	data := `{"positions":{"farleft":{"x":"10%","y":"100%","anchor":[0.5,1]},"left":{"x":100,"y":"100%","anchor":[0,1]}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	want := []string{"center", "farleft", "left", "right"}
+	if got := cfg.PositionNames(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("PositionNames = %v, want %v", got, want)
+	}
+	if got := cfg.Positions["left"].X; got != script.Px(100) {
+		t.Fatalf("left preset not overridden: %+v", got)
+	}
+}
+
+func TestBackgroundFor(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "project.json")
+	data := `{"background": {"fit": "cover"}, "backgrounds": {"wide.png": {"fit": "contain", "color": "#202020"}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.BackgroundFor("room.jpg"); got != (Background{Fit: FitCover, Color: "#000000"}) {
+		t.Errorf("default background = %+v", got)
+	}
+	if got := cfg.BackgroundFor("wide.png"); got != (Background{Fit: FitContain, Color: "#202020"}) {
+		t.Errorf("override = %+v", got)
+	}
+}
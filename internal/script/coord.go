@@ -0,0 +1,61 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Coord is a screen coordinate given either in pixels or as a percentage of
+// the screen size. In JSON it is written as a number of pixels, or as a
+// string such as "120", "120px" or "35%".
+type Coord struct {
+	Value   float64
+	Percent bool
+}
+
+// Px returns a coordinate in pixels.
+func Px(v float64) Coord { return Coord{Value: v} }
+
+// Pct returns a coordinate as a percentage of the screen size.
+func Pct(v float64) Coord { return Coord{Value: v, Percent: true} }
+
+// Resolve converts c to pixels along an axis of the given length.
+func (c Coord) Resolve(length float64) float64 {
+	if c.Percent {
+		return c.Value / 100 * length
+	}
+	return c.Value
+}
+
+// UnmarshalJSON accepts a number or a string with an optional px or %
+// suffix.
+func (c *Coord) UnmarshalJSON(data []byte) error {
+	var n float64
+	if err := json.Unmarshal(data, &n); err == nil {
+		*c = Px(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("script: coordinate must be a number or string, got %s", data)
+	}
+	s = strings.TrimSpace(s)
+	pct := strings.HasSuffix(s, "%")
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "%"), "px")
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return fmt.Errorf("script: bad coordinate %q", s)
+	}
+	*c = Coord{Value: v, Percent: pct}
+	return nil
+}
+
+// MarshalJSON writes percentages as strings and pixels as numbers.
+func (c Coord) MarshalJSON() ([]byte, error) {
+	if c.Percent {
+		return json.Marshal(strconv.FormatFloat(c.Value, 'f', -1, 64) + "%")
+	}
+	return json.Marshal(c.Value)
+}
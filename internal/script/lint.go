@@ -0,0 +1,108 @@
+package script
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+)
+
+var colorPattern = regexp.MustCompile(`^#?([0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// Warning is a problem found in a script that does not stop it from loading.
+type Warning struct {
+	Page int
+	Msg  string
+}
+
+func (w Warning) String() string { return fmt.Sprintf("page %d: %s", w.Page, w.Msg) }
+
+// LintOptions describes the project the script is checked against.
+type LintOptions struct {
+	// Positions lists the known sprite position preset names.
+	Positions []string
+}
+
+// Lint checks pages for mistakes such as unknown position presets, including
+// motion destinations, malformed effect colours, unknown audio channels and
+// choices that lead nowhere.
+func Lint(pages []*Page, opts LintOptions) []Warning {
+	known := map[string]bool{}
+	for _, p := range opts.Positions {
+		known[p] = true
+	}
+	var warns []Warning
+	warn := func(page int, format string, args ...interface{}) {
+		warns = append(warns, Warning{Page: page, Msg: fmt.Sprintf(format, args...)})
+	}
+	checkPos := func(page int, id, pos string) {
+		if pos != "" && !known[pos] {
+			warn(page, "sprite %q uses unknown position %q", id, pos)
+		}
+	}
+	checkChannel := func(page int, ch string) {
+		if !slices.Contains(Channels, ch) {
+			warn(page, "unknown audio channel %q", ch)
+		}
+	}
+	checkColor := func(page int, what, c string) {
+		if c != "" && !colorPattern.MatchString(c) {
+			warn(page, "%s has bad colour %q", what, c)
+		}
+	}
+
+	for i, p := range pages {
+		if st := p.Stage; st != nil {
+			for _, s := range st.Sprites {
+				checkPos(i, s.ID, s.Pos)
+			}
+			for _, s := range st.Show {
+				checkPos(i, s.ID, s.Pos)
+			}
+			ids := make([]string, 0, len(st.Move))
+			for id := range st.Move {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			for _, id := range ids {
+				checkPos(i, id, st.Move[id])
+			}
+			if e := st.Effect; e != nil {
+				if e.Tint != nil {
+					checkColor(i, "tint", *e.Tint)
+				}
+				checkColor(i, "flash", e.Flash)
+			}
+			if tr := st.Transition; tr != nil {
+				checkColor(i, "transition", tr.Color)
+			}
+			for _, m := range st.Motion {
+				if m.Type == MotionMove {
+					checkPos(i, m.Target, m.To)
+				}
+			}
+		}
+		if a := p.Audio; a != nil {
+			for _, s := range a.Stop {
+				checkChannel(i, s.Channel)
+			}
+			chans := make([]string, 0, len(a.Volume))
+			for ch := range a.Volume {
+				chans = append(chans, ch)
+			}
+			sort.Strings(chans)
+			for _, ch := range chans {
+				checkChannel(i, ch)
+				if v := a.Volume[ch]; v < 0 || v > 1 {
+					warn(i, "channel %q has volume %v outside 0 to 1", ch, v)
+				}
+			}
+		}
+		for _, c := range p.Choices {
+			if c.Page < 0 || c.Page >= len(pages) {
+				warn(i, "choice %q leads to missing page %d", c.Text, c.Page)
+			}
+		}
+	}
+	return warns
+}
@@ -4,49 +4,398 @@ import (
 	"encoding/json"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"novegido/internal/anim"
 )
 
-// SpriteInfo describes a character sprite on screen.
+// SpriteInfo describes a character sprite on screen. The image is either
+// given directly by File, by a character reference such as "kuro:joy" in
+// File, or by ID and Expr looked up in the character registry.
+//
+// Layers picks the parts of a layered character by slot, for example
+// {"outfit": "winter"}; Expr picks the face.
+//
+// Pos names a position preset from the project settings. X, Y and Anchor
+// override the preset; the anchor is the point of the sprite, as fractions
+// of its width and height, that is placed at (X, Y).
 type SpriteInfo struct {
-	ID   string `json:"id"`
-	File string `json:"file"`
-	Pos  string `json:"pos"`
+	ID     string            `json:"id"`
+	File   string            `json:"file,omitempty"`
+	Expr   string            `json:"expr,omitempty"`
+	Layers map[string]string `json:"layers,omitempty"`
+	Pos    string            `json:"pos"`
+	// FadeMs overrides the page's sprite fade for this sprite when it
+	// appears, changes expression or is hidden.
+	FadeMs int `json:"fadeMs,omitempty"`
+
+	X       *Coord      `json:"x,omitempty"`
+	Y       *Coord      `json:"y,omitempty"`
+	Anchor  *[2]float64 `json:"anchor,omitempty"`
+	Scale   float64     `json:"scale,omitempty"`
+	Flip    bool        `json:"flip,omitempty"`
+	Z       int         `json:"z,omitempty"`
+	Opacity *float64    `json:"opacity,omitempty"`
 }
 
-// StageInfo describes background and sprite placement along with transitions.
+// StageInfo describes changes to the background and sprites along with
+// transitions. The stage persists between pages; sprites are changed with
+// the incremental operations Show, Hide, Expr, Layers and Move, keyed by
+// SpriteInfo.ID. Sprites, when present, replaces the whole sprite set first.
+// Fade durations may be given in milliseconds or, for older scripts, as frame
+// counts at 60 frames per second; milliseconds take precedence.
 type StageInfo struct {
-	BG         string       `json:"bg"`
-	Sprites    []SpriteInfo `json:"sprites"`
-	BGFade     int          `json:"bgFade,omitempty"`
-	SpriteFade int          `json:"spriteFade,omitempty"`
+	BG      string       `json:"bg"`
+	Sprites []SpriteInfo `json:"sprites"`
+	// Show adds sprites. For an ID already shown it replaces the sprite,
+	// keeping the current image when no File or Expr is given, the current
+	// layers when none are given and the current position when no Pos, X
+	// or Y is given.
+	Show []SpriteInfo `json:"show,omitempty"`
+	// Hide removes the sprites with the given IDs.
+	Hide []string `json:"hide,omitempty"`
+	// Expr changes the expression of shown sprites, by ID.
+	Expr map[string]string `json:"expr,omitempty"`
+	// Layers changes parts of shown layered sprites, by ID and then slot,
+	// leaving other slots as they are.
+	Layers map[string]map[string]string `json:"layers,omitempty"`
+	// Move changes the position of shown sprites, by ID.
+	Move map[string]string `json:"move,omitempty"`
+	// Motion starts animations once the other operations are applied.
+	Motion []MotionInfo `json:"motion,omitempty"`
+	// Transition selects how a background change is drawn; nil crossfades.
+	Transition *TransitionInfo `json:"transition,omitempty"`
+	// Effect changes the screen-wide effects.
+	Effect *EffectInfo `json:"effect,omitempty"`
+	// Camera pans and zooms the view of the stage.
+	Camera *CameraInfo `json:"camera,omitempty"`
+	// Particles starts and stops weather and ambient particle emitters.
+	Particles *ParticlesInfo `json:"particles,omitempty"`
+	// Foreground shows an image in front of the sprites, CG one that
+	// covers the background, sprites and foreground, and Overlay one over
+	// everything, screen effects included.
+	Foreground *LayerInfo `json:"foreground,omitempty"`
+	CG         *LayerInfo `json:"cg,omitempty"`
+	Overlay    *LayerInfo `json:"overlay,omitempty"`
+
+	BGFade       int    `json:"bgFade,omitempty"`
+	SpriteFade   int    `json:"spriteFade,omitempty"`
+	BGFadeMs     int    `json:"bgFadeMs,omitempty"`
+	SpriteFadeMs int    `json:"spriteFadeMs,omitempty"`
+	Easing       string `json:"easing,omitempty"`
+}
+
+// Motion types.
+const (
+	// MotionMove glides a sprite to the preset To or to X and Y.
+	MotionMove = "move"
+	// MotionSlideIn brings a sprite in from off-screen on the side From.
+	MotionSlideIn = "slideIn"
+	// MotionHop makes a sprite jump Count times, Amount pixels high.
+	MotionHop = "hop"
+	// MotionShake shakes a sprite, or the screen, Amount pixels sideways.
+	MotionShake = "shake"
+	// MotionZoom scales a sprite to Amount. On the screen it punches in to
+	// Amount and back out.
+	MotionZoom = "zoom"
+)
+
+// MotionTargetScreen makes a motion apply to the whole stage.
+const MotionTargetScreen = "screen"
+
+// MotionInfo describes an animation of a sprite, by ID, or of the screen.
+type MotionInfo struct {
+	Target     string  `json:"target"`
+	Type       string  `json:"type"`
+	To         string  `json:"to,omitempty"`
+	X          *Coord  `json:"x,omitempty"`
+	Y          *Coord  `json:"y,omitempty"`
+	From       string  `json:"from,omitempty"`
+	Amount     float64 `json:"amount,omitempty"`
+	Count      int     `json:"count,omitempty"`
+	DurationMs int     `json:"durationMs"`
+	Easing     string  `json:"easing,omitempty"`
+}
+
+// Duration returns how long the motion lasts.
+func (m MotionInfo) Duration() time.Duration {
+	return time.Duration(m.DurationMs) * time.Millisecond
+}
+
+// LayerInfo changes the image of a full-screen layer. File replaces the
+// current image with one from the layer's directory under assets, and Hide
+// removes it. The change takes FadeMs, drawn with Transition when given and
+// crossfaded otherwise; a dissolve ignores its colour and fades through
+// the stage beneath. Layers persist across pages until changed.
+type LayerInfo struct {
+	File       string          `json:"file,omitempty"`
+	Hide       bool            `json:"hide,omitempty"`
+	FadeMs     int             `json:"fadeMs,omitempty"`
+	Transition *TransitionInfo `json:"transition,omitempty"`
+	Easing     string          `json:"easing,omitempty"`
+}
+
+// Duration returns how long the layer change takes.
+func (l LayerInfo) Duration() time.Duration {
+	return time.Duration(l.FadeMs) * time.Millisecond
+}
+
+// TransitionInfo describes a background or layer transition. Type is one of "fade",
+// "wipe", "slide", "push", "iris", "pixelate", "dissolve" or "rule".
+// Direction applies to wipes and slides, Rule names a grayscale image in
+// assets/rules whose dark areas are revealed first, Softness widens the
+// blended edge of wipes, irises and rules, Color is the colour a dissolve
+// passes through and Block the largest pixelate block in pixels.
+type TransitionInfo struct {
+	Type      string  `json:"type"`
+	Direction string  `json:"direction,omitempty"`
+	Rule      string  `json:"rule,omitempty"`
+	Softness  float64 `json:"softness,omitempty"`
+	Color     string  `json:"color,omitempty"`
+	Block     int     `json:"block,omitempty"`
+}
+
+// Screen filters.
+const (
+	FilterSepia     = "sepia"
+	FilterGrayscale = "grayscale"
+)
+
+// EffectInfo changes the screen-wide effects drawn over the stage. Filter,
+// Tint, Vignette and Blur persist across pages until changed; a field left
+// out keeps its current setting and Clear resets them all first. Tint is a
+// colour whose alpha is the strength, Vignette a strength from 0 to 1 and
+// Blur a radius in pixels. Changes fade over FadeMs. Flash briefly covers
+// the screen with a colour that fades out over FlashMs.
+type EffectInfo struct {
+	Filter   *string  `json:"filter,omitempty"`
+	Tint     *string  `json:"tint,omitempty"`
+	Vignette *float64 `json:"vignette,omitempty"`
+	Blur     *float64 `json:"blur,omitempty"`
+	Clear    bool     `json:"clear,omitempty"`
+	FadeMs   int      `json:"fadeMs,omitempty"`
+	Flash    string   `json:"flash,omitempty"`
+	FlashMs  int      `json:"flashMs,omitempty"`
 }
 
-// DialogueInfo holds spoken text and speaker name.
+// ParticlesInfo starts and stops particle emitters, named as in the
+// project's particle file. Running emitters persist across pages until
+// stopped; a stopped emitter spawns no more particles and those already
+// falling live out their lifetimes. Clear stops every emitter first.
+type ParticlesInfo struct {
+	Start []string `json:"start,omitempty"`
+	Stop  []string `json:"stop,omitempty"`
+	Clear bool     `json:"clear,omitempty"`
+}
+
+// CameraInfo moves the stage camera over DurationMs. X and Y are the centre
+// of the view as fractions of the background and Zoom magnifies it, 1
+// showing the background at its own size, so that a wide background can be
+// panned across; Focus centres on the sprite with that ID instead. Fields
+// left out keep their current value and Reset returns to the whole stage.
+// From, when given, is the view the move starts from, which makes slow Ken
+// Burns drifts a single command.
+type CameraInfo struct {
+	X          *float64    `json:"x,omitempty"`
+	Y          *float64    `json:"y,omitempty"`
+	Zoom       float64     `json:"zoom,omitempty"`
+	Focus      string      `json:"focus,omitempty"`
+	Reset      bool        `json:"reset,omitempty"`
+	From       *CameraInfo `json:"from,omitempty"`
+	DurationMs int         `json:"durationMs,omitempty"`
+	Easing     string      `json:"easing,omitempty"`
+}
+
+// BGFadeDuration returns how long the background transition lasts.
+func (s *StageInfo) BGFadeDuration() time.Duration {
+	return fadeDuration(s.BGFadeMs, s.BGFade)
+}
+
+// SpriteFadeDuration returns how long the sprite transition lasts.
+func (s *StageInfo) SpriteFadeDuration() time.Duration {
+	return fadeDuration(s.SpriteFadeMs, s.SpriteFade)
+}
+
+func fadeDuration(ms, frames int) time.Duration {
+	if ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return anim.FramesToDuration(frames)
+}
+
+// DialogueInfo holds spoken text and speaker name. Speaker may be a
+// character ID from the registry or a name shown as written. Voice names a
+// voice file, relative to the speaker's voice directory, and Expr picks the
+// side portrait shown with the line.
 type DialogueInfo struct {
 	Speaker string `json:"speaker"`
 	Text    string `json:"text"`
+	Voice   string `json:"voice,omitempty"`
+	Expr    string `json:"expr,omitempty"`
 }
 
-// AudioInfo describes a sound file that should be played.
+// Audio channels. BGM and ambience loop, one track each; sound effects play
+// once and may overlap; voice plays the dialogue's voice lines.
+const (
+	ChannelBGM     = "bgm"
+	ChannelSE      = "se"
+	ChannelVoice   = "voice"
+	ChannelAmbient = "ambient"
+)
+
+// Channels lists every audio channel.
+var Channels = []string{ChannelBGM, ChannelSE, ChannelVoice, ChannelAmbient}
+
+// AudioInfo changes what plays on the audio channels when a page is entered.
+// Stop silences channels first, Volume sets channel volumes from 0 to 1 and
+// BGM and Ambient replace the looping track of their channel, which keeps
+// playing across pages. Each SE plays once. The older File and Loop play a
+// looping file as BGM and anything else as a sound effect.
 type AudioInfo struct {
-	File string `json:"file"`
-	Loop bool   `json:"loop"`
+	File    string             `json:"file,omitempty"`
+	Loop    bool               `json:"loop,omitempty"`
+	BGM     *TrackInfo         `json:"bgm,omitempty"`
+	Ambient *TrackInfo         `json:"ambient,omitempty"`
+	SE      []TrackInfo        `json:"se,omitempty"`
+	Stop    []StopInfo         `json:"stop,omitempty"`
+	Volume  map[string]float64 `json:"volume,omitempty"`
+}
+
+// Stops reports whether a stops channel.
+func (a *AudioInfo) Stops(channel string) bool {
+	for _, s := range a.Stop {
+		if s.Channel == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// StopInfo stops a channel, fading it out over FadeMs. A bare string in
+// JSON is taken as the channel.
+type StopInfo struct {
+	Channel string `json:"channel"`
+	FadeMs  int    `json:"fadeMs,omitempty"`
+}
+
+// UnmarshalJSON accepts either a channel name or a full stop object.
+func (s *StopInfo) UnmarshalJSON(data []byte) error {
+	var ch string
+	if err := json.Unmarshal(data, &ch); err == nil {
+		*s = StopInfo{Channel: ch}
+		return nil
+	}
+	type plain StopInfo
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// Fade returns how long the channel takes to fall silent.
+func (s StopInfo) Fade() time.Duration {
+	return time.Duration(s.FadeMs) * time.Millisecond
+}
+
+// TrackInfo is a file played on a channel. Volume, from 0 to 1, is scaled
+// by the channel's volume and is full when unset. A bare string in JSON is
+// taken as the file.
+//
+// When a BGM or ambient track replaces another, FadeOutMs fades the old
+// track out before the new one starts and FadeInMs fades the new one in.
+// CrossfadeMs instead fades the old track out while the new one fades in,
+// and takes precedence over the other two.
+type TrackInfo struct {
+	File        string   `json:"file"`
+	Volume      *float64 `json:"volume,omitempty"`
+	FadeInMs    int      `json:"fadeInMs,omitempty"`
+	FadeOutMs   int      `json:"fadeOutMs,omitempty"`
+	CrossfadeMs int      `json:"crossfadeMs,omitempty"`
+}
+
+// UnmarshalJSON accepts either a file name or a full track object.
+func (t *TrackInfo) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = TrackInfo{File: s}
+		return nil
+	}
+	type plain TrackInfo
+	return json.Unmarshal(data, (*plain)(t))
 }
 
-// ChoiceInfo represents a selectable option leading to another page.
+// ChoiceInfo represents a selectable option leading to another page. If,
+// when given, shows the choice only while a game variable holds: "name"
+// asks for the variable to be set and "name=value" for it to equal value.
 type ChoiceInfo struct {
 	Text string `json:"text"`
 	Page int    `json:"page"`
+	If   string `json:"if,omitempty"`
+}
+
+// Shown reports whether the choice's condition holds for vars.
+func (c ChoiceInfo) Shown(vars map[string]string) bool {
+	if c.If == "" {
+		return true
+	}
+	name, want, ok := strings.Cut(c.If, "=")
+	got, set := vars[name]
+	if !ok {
+		return set && got != ""
+	}
+	return got == want
+}
+
+// VisibleChoices returns the choices whose conditions hold for vars.
+func VisibleChoices(choices []ChoiceInfo, vars map[string]string) []ChoiceInfo {
+	var out []ChoiceInfo
+	for _, c := range choices {
+		if c.Shown(vars) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Writing modes select the direction dialogue text is set in.
+const (
+	WritingHorizontal = "horizontal"
+	WritingVertical   = "vertical"
+)
+
+// Presentation modes select how dialogue is shown. ADV shows one line at a
+// time in the dialogue box; NVL accumulates lines on a full-screen panel.
+const (
+	ModeADV = "adv"
+	ModeNVL = "nvl"
+)
+
+// Ruby is a reading annotation over the runes [Start, End) of a page's clean
+// dialogue text.
+type Ruby struct {
+	Start int
+	End   int
+	Text  string
 }
 
 // Page is a single entry of a script.
 type Page struct {
+	Label    string        `json:"label,omitempty"`
 	Stage    *StageInfo    `json:"stage,omitempty"`
 	Dialogue *DialogueInfo `json:"dialogue,omitempty"`
 	Audio    *AudioInfo    `json:"audio,omitempty"`
 	Choices  []ChoiceInfo  `json:"choices,omitempty"`
-	Clean    string        `json:"-"`
+	// Writing selects horizontal or vertical text. It applies to the rest
+	// of the scene, so pages that leave it empty inherit the previous
+	// page's mode.
+	Writing string `json:"writing,omitempty"`
+	// Mode selects ADV or NVL presentation and, like Writing, carries over
+	// to following pages until changed.
+	Mode string `json:"mode,omitempty"`
+	// Clear wipes the NVL panel before this page's line is added.
+	Clear bool   `json:"clear,omitempty"`
+	Clean string `json:"-"`
+	Ruby  []Ruby `json:"-"`
 }
 
 // LoadScripts reads a JSON script file and returns parsed pages.
@@ -62,17 +411,73 @@ func LoadScripts(path string) ([]*Page, error) {
 		return nil, err
 	}
 
+	writing, mode := WritingHorizontal, ModeADV
 	for _, p := range pages {
+		if p.Writing == "" {
+			p.Writing = writing
+		}
+		writing = p.Writing
+		if p.Mode == "" {
+			p.Mode = mode
+		}
+		mode = p.Mode
 		if p.Dialogue != nil {
-			p.Clean = ParseDialogue(p.Dialogue.Text)
+			p.Clean, p.Ruby = ParseDialogueRuby(p.Dialogue.Text)
 		}
 	}
 	return pages, nil
 }
 
-// ParseDialogue removes any markup such as HTML tags and normalises whitespace.
+// FindPage resolves a page reference given either as a numeric index or as a
+// page label. It returns -1 when nothing matches.
+func FindPage(pages []*Page, ref string) int {
+	if i, err := strconv.Atoi(ref); err == nil {
+		if i >= 0 && i < len(pages) {
+			return i
+		}
+		return -1
+	}
+	for i, p := range pages {
+		if p.Label != "" && p.Label == ref {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseDialogue removes any markup such as HTML tags and ruby annotations and
+// normalises whitespace.
 func ParseDialogue(src string) string {
+	out, _ := ParseDialogueRuby(src)
+	return out
+}
+
+var (
+	tagPattern  = regexp.MustCompile(`<[^>]+>`)
+	rubyPattern = regexp.MustCompile(`\{([^|{}]+)\|([^{}]+)\}`)
+)
+
+// ParseDialogueRuby behaves like ParseDialogue but also extracts ruby written
+// as {base|reading}. The returned annotations index runes of the clean text.
+func ParseDialogueRuby(src string) (string, []Ruby) {
 	out := strings.ReplaceAll(src, "\n", " ")
-	out = regexp.MustCompile(`<[^>]+>`).ReplaceAllString(out, "")
-	return strings.TrimSpace(out)
+	out = tagPattern.ReplaceAllString(out, "")
+	out = strings.TrimSpace(out)
+
+	var b strings.Builder
+	var ruby []Ruby
+	pos := 0
+	last := 0
+	for _, m := range rubyPattern.FindAllStringSubmatchIndex(out, -1) {
+		b.WriteString(out[last:m[0]])
+		pos += utf8.RuneCountInString(out[last:m[0]])
+		base := out[m[2]:m[3]]
+		n := utf8.RuneCountInString(base)
+		ruby = append(ruby, Ruby{Start: pos, End: pos + n, Text: out[m[4]:m[5]]})
+		b.WriteString(base)
+		pos += n
+		last = m[1]
+	}
+	b.WriteString(out[last:])
+	return b.String(), ruby
 }
@@ -4,8 +4,11 @@
 package script
 
 import (
+	"encoding/json"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestParseDialogue(t *testing.T) {
@@ -57,6 +60,30 @@ func TestLoadScriptsChoices(t *testing.T) {
 	}
 }
 
+func TestChoiceConditions(t *testing.T) {
+	choices := []ChoiceInfo{
+		{Text: "always"},
+		{Text: "met", If: "met"},
+		{Text: "kuro route", If: "route=kuro"},
+	}
+	texts := func(vars map[string]string) []string {
+		var out []string
+		for _, c := range VisibleChoices(choices, vars) {
+			out = append(out, c.Text)
+		}
+		return out
+	}
+	if got := texts(nil); !reflect.DeepEqual(got, []string{"always"}) {
+		t.Errorf("no vars: %v", got)
+	}
+	if got := texts(map[string]string{"met": "yes", "route": "siro"}); !reflect.DeepEqual(got, []string{"always", "met"}) {
+		t.Errorf("met on siro's route: %v", got)
+	}
+	if got := texts(map[string]string{"route": "kuro"}); !reflect.DeepEqual(got, []string{"always", "kuro route"}) {
+		t.Errorf("kuro's route: %v", got)
+	}
+}
+
 func TestLoadScriptsTransitions(t *testing.T) {
 	tmp, err := os.CreateTemp("", "script*.json")
 	if err != nil {
@@ -81,3 +108,198 @@ func TestLoadScriptsTransitions(t *testing.T) {
 		t.Fatalf("transitions not parsed: %+v", st)
 	}
 }
+
+func TestFindPage(t *testing.T) {
+	pages := []*Page{{}, {Label: "intro"}, {}}
+	tests := []struct {
+		ref  string
+		want int
+	}{
+		{"0", 0},
+		{"2", 2},
+		{"3", -1},
+		{"intro", 1},
+		{"missing", -1},
+	}
+	for _, tt := range tests {
+		if got := FindPage(pages, tt.ref); got != tt.want {
+			t.Errorf("FindPage(%q) = %d, want %d", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestStageFadeDurations(t *testing.T) {
+	st := &StageInfo{BGFade: 30, SpriteFade: 60, SpriteFadeMs: 250}
+	if got := st.BGFadeDuration(); got != 500*time.Millisecond {
+		t.Errorf("BGFadeDuration = %v, want 500ms", got)
+	}
+	if got := st.SpriteFadeDuration(); got != 250*time.Millisecond {
+		t.Errorf("SpriteFadeDuration = %v, want 250ms", got)
+	}
+}
+
+func TestParseDialogueRuby(t *testing.T) {
+	clean, ruby := ParseDialogueRuby("<b>{錬金術|れんきんじゅつ}</b>と{賢者|けんじゃ}の石")
+	if clean != "錬金術と賢者の石" {
+		t.Fatalf("clean = %q", clean)
+	}
+	want := []Ruby{{0, 3, "れんきんじゅつ"}, {4, 6, "けんじゃ"}}
+	if !reflect.DeepEqual(ruby, want) {
+		t.Fatalf("ruby = %+v, want %+v", ruby, want)
+	}
+	if got := ParseDialogue("{漢字|かんじ}"); got != "漢字" {
+		t.Fatalf("ParseDialogue should drop ruby, got %q", got)
+	}
+}
+
+func TestLoadScriptsSceneSettingsInherited(t *testing.T) {
+	tmp, err := os.CreateTemp("", "script*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	data := `[{}, {"writing":"vertical","mode":"nvl"}, {}, {"writing":"horizontal"}, {"mode":"adv"}]`
+	if _, err := tmp.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+
+	pages, err := LoadScripts(tmp.Name())
+	if err != nil {
+		t.Fatalf("LoadScripts error: %v", err)
+	}
+	want := []string{WritingHorizontal, WritingVertical, WritingVertical, WritingHorizontal, WritingHorizontal}
+	wantMode := []string{ModeADV, ModeNVL, ModeNVL, ModeNVL, ModeADV}
+	for i, p := range pages {
+		if p.Writing != want[i] {
+			t.Errorf("page %d writing = %q, want %q", i, p.Writing, want[i])
+		}
+		if p.Mode != wantMode[i] {
+			t.Errorf("page %d mode = %q, want %q", i, p.Mode, wantMode[i])
+		}
+	}
+}
+
+func TestCoordUnmarshal(t *testing.T) {
+	var s SpriteInfo
+	data := `{"id":"k","x":"35%","y":120,"anchor":[0.5,1],"scale":1.5,"flip":true,"z":2,"opacity":0.5}`
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if *s.X != Pct(35) || *s.Y != Px(120) {
+		t.Fatalf("coords = %+v %+v", *s.X, *s.Y)
+	}
+	if s.X.Resolve(200) != 70 || s.Y.Resolve(200) != 120 {
+		t.Fatalf("resolve = %v %v", s.X.Resolve(200), s.Y.Resolve(200))
+	}
+	if *s.Anchor != [2]float64{0.5, 1} || s.Scale != 1.5 || !s.Flip || s.Z != 2 || *s.Opacity != 0.5 {
+		t.Fatalf("unexpected sprite: %+v", s)
+	}
+	var c Coord
+	if err := json.Unmarshal([]byte(`"12px"`), &c); err != nil || c != Px(12) {
+		t.Fatalf("px suffix: %+v %v", c, err)
+	}
+	if err := json.Unmarshal([]byte(`"abc"`), &c); err == nil {
+		t.Fatal("expected error for bad coordinate")
+	}
+}
+
+func TestLint(t *testing.T) {
+	pages := []*Page{
+		{Stage: &StageInfo{
+			Sprites: []SpriteInfo{{ID: "a", Pos: "left"}},
+			Show:    []SpriteInfo{{ID: "b", Pos: "farleft"}},
+			Move:    map[string]string{"a": "centre"},
+		}},
+		{Choices: []ChoiceInfo{{Text: "go", Page: 5}}},
+	}
+	warns := Lint(pages, LintOptions{Positions: []string{"left", "center", "right"}})
+	want := []string{
+		`page 0: sprite "b" uses unknown position "farleft"`,
+		`page 0: sprite "a" uses unknown position "centre"`,
+		`page 1: choice "go" leads to missing page 5`,
+	}
+	if len(warns) != len(want) {
+		t.Fatalf("warnings = %v", warns)
+	}
+	for i, w := range warns {
+		if w.String() != want[i] {
+			t.Errorf("warning %d = %q, want %q", i, w, want[i])
+		}
+	}
+}
+
+func TestLintMotionDestination(t *testing.T) {
+	pages := []*Page{{Stage: &StageInfo{Motion: []MotionInfo{
+		{Target: "a", Type: MotionMove, To: "nowhere"},
+		{Target: "a", Type: MotionHop},
+	}}}}
+	warns := Lint(pages, LintOptions{Positions: []string{"left"}})
+	if len(warns) != 1 || warns[0].Msg != `sprite "a" uses unknown position "nowhere"` {
+		t.Fatalf("unexpected warnings: %v", warns)
+	}
+}
+
+func TestLintColors(t *testing.T) {
+	tint := "red"
+	pages := []*Page{{Stage: &StageInfo{
+		Effect:     &EffectInfo{Tint: &tint, Flash: "#ffffff"},
+		Transition: &TransitionInfo{Type: "dissolve", Color: "#00000"},
+	}}}
+	warns := Lint(pages, LintOptions{})
+	if len(warns) != 2 {
+		t.Fatalf("unexpected warnings: %v", warns)
+	}
+	if warns[0].Msg != `tint has bad colour "red"` || warns[1].Msg != `transition has bad colour "#00000"` {
+		t.Fatalf("unexpected warnings: %v", warns)
+	}
+}
+
+func TestAudioInfoJSON(t *testing.T) {
+	var a AudioInfo
+	data := `{"bgm":"town.mp3","se":["door.mp3",{"file":"bell.mp3","volume":0.5}],"stop":["ambient"],"volume":{"voice":0.8}}`
+	if err := json.Unmarshal([]byte(data), &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.BGM == nil || !reflect.DeepEqual(*a.BGM, TrackInfo{File: "town.mp3"}) {
+		t.Fatalf("BGM = %+v", a.BGM)
+	}
+	half := 0.5
+	want := []TrackInfo{{File: "door.mp3"}, {File: "bell.mp3", Volume: &half}}
+	if !reflect.DeepEqual(a.SE, want) {
+		t.Fatalf("SE = %+v, want %+v", a.SE, want)
+	}
+	if !a.Stops(ChannelAmbient) || a.Volume[ChannelVoice] != 0.8 {
+		t.Fatalf("unexpected audio: %+v", a)
+	}
+}
+
+func TestLintAudio(t *testing.T) {
+	pages := []*Page{{Audio: &AudioInfo{
+		Stop:   []StopInfo{{Channel: "bgm"}, {Channel: "music"}},
+		Volume: map[string]float64{"se": 1.5},
+	}}}
+	warns := Lint(pages, LintOptions{})
+	if len(warns) != 2 || warns[0].Msg != `unknown audio channel "music"` ||
+		warns[1].Msg != `channel "se" has volume 1.5 outside 0 to 1` {
+		t.Fatalf("unexpected warnings: %v", warns)
+	}
+}
+
+func TestAudioFadesJSON(t *testing.T) {
+	var a AudioInfo
+	data := `{"bgm":{"file":"night.mp3","crossfadeMs":2000},"stop":["se",{"channel":"ambient","fadeMs":500}]}`
+	if err := json.Unmarshal([]byte(data), &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.BGM.CrossfadeMs != 2000 {
+		t.Fatalf("BGM = %+v", a.BGM)
+	}
+	want := []StopInfo{{Channel: ChannelSE}, {Channel: ChannelAmbient, FadeMs: 500}}
+	if !reflect.DeepEqual(a.Stop, want) {
+		t.Fatalf("Stop = %+v, want %+v", a.Stop, want)
+	}
+	if a.Stop[1].Fade() != 500*time.Millisecond {
+		t.Fatalf("Fade = %v", a.Stop[1].Fade())
+	}
+}
@@ -0,0 +1,179 @@
+// Package transition implements the per-pixel math of background
+// transitions. Wipes, irises and rule images are all expressed as a reveal
+// order: a value in [0, 1] per pixel saying how early in the transition that
+// pixel switches to the new image. Renderers turn the reveal order into an
+// alpha mask with Mask and draw the new image through it.
+package transition
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Transition types.
+const (
+	Fade     = "fade"
+	Wipe     = "wipe"
+	Slide    = "slide"
+	Push     = "push"
+	Iris     = "iris"
+	Pixelate = "pixelate"
+	Dissolve = "dissolve"
+	Rule     = "rule"
+)
+
+// Directions give the way a wipe travels or an image slides.
+const (
+	Left  = "left"
+	Right = "right"
+	Up    = "up"
+	Down  = "down"
+)
+
+// Alpha returns the opacity of the new image at a pixel whose reveal order
+// is v when the transition is at progress p. With zero softness pixels
+// switch at once; otherwise each pixel fades in over a band of the given
+// width, so the whole transition still runs from fully old at p = 0 to fully
+// new at p = 1.
+func Alpha(v, p, softness float64) float64 {
+	switch {
+	case p <= 0:
+		return 0
+	case p >= 1:
+		return 1
+	case softness <= 0:
+		if v < p {
+			return 1
+		}
+		return 0
+	}
+	a := (p*(1+softness) - v) / softness
+	return math.Max(0, math.Min(1, a))
+}
+
+// Mask writes the alpha mask for order at progress p into pix as
+// premultiplied RGBA, four bytes per pixel.
+func Mask(pix []byte, order []float64, p, softness float64) {
+	for i, v := range order {
+		writeAlpha(pix, i, Alpha(v, p, softness))
+	}
+}
+
+// InverseMask writes the mask that hides the old image as Mask reveals the
+// new one, for images that do not cover what lies beneath them.
+func InverseMask(pix []byte, order []float64, p, softness float64) {
+	for i, v := range order {
+		writeAlpha(pix, i, 1-Alpha(v, p, softness))
+	}
+}
+
+func writeAlpha(pix []byte, i int, alpha float64) {
+	a := byte(alpha*255 + 0.5)
+	pix[4*i], pix[4*i+1], pix[4*i+2], pix[4*i+3] = a, a, a, a
+}
+
+// Ramp returns the reveal order of a wipe of a w×h image travelling in dir.
+// Unknown directions wipe to the right.
+func Ramp(w, h int, dir string) []float64 {
+	order := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v float64
+			switch dir {
+			case Left:
+				v = 1 - frac(x, w)
+			case Down:
+				v = frac(y, h)
+			case Up:
+				v = 1 - frac(y, h)
+			default:
+				v = frac(x, w)
+			}
+			order[y*w+x] = v
+		}
+	}
+	return order
+}
+
+// IrisOrder returns the reveal order of an iris opening from the centre of
+// a w×h image.
+func IrisOrder(w, h int) []float64 {
+	order := make([]float64, w*h)
+	cx, cy := float64(w)/2, float64(h)/2
+	max := math.Hypot(cx, cy)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy)
+			order[y*w+x] = math.Min(1, d/max)
+		}
+	}
+	return order
+}
+
+// FromImage returns the reveal order given by a grayscale rule image
+// stretched to w×h: dark pixels are revealed first.
+func FromImage(img image.Image, w, h int) []float64 {
+	order := make([]float64, w*h)
+	b := img.Bounds()
+	for y := 0; y < h; y++ {
+		sy := b.Min.Y + y*b.Dy()/h
+		for x := 0; x < w; x++ {
+			sx := b.Min.X + x*b.Dx()/w
+			g := color.Gray16Model.Convert(img.At(sx, sy)).(color.Gray16)
+			order[y*w+x] = float64(g.Y) / 0xffff
+		}
+	}
+	return order
+}
+
+// SlideOffset returns how far the new image is displaced at progress p when
+// it slides in travelling in dir across a w×h screen. With push, the old
+// image is displaced by the same amount plus one screen in dir.
+func SlideOffset(dir string, p float64, w, h int) (dx, dy float64) {
+	r := 1 - p
+	switch dir {
+	case Left:
+		return r * float64(w), 0
+	case Down:
+		return 0, -r * float64(h)
+	case Up:
+		return 0, r * float64(h)
+	default:
+		return -r * float64(w), 0
+	}
+}
+
+// PixelBlock returns the block size to draw at progress p for a pixelate
+// transition growing to max pixels, and whether the new image is shown. The
+// old image coarsens during the first half and the new one sharpens during
+// the second.
+func PixelBlock(p float64, max int) (size int, incoming bool) {
+	if max < 1 {
+		max = 1
+	}
+	t := 2 * p
+	incoming = p >= 0.5
+	if incoming {
+		t = 2 - t
+	}
+	size = 1 + int(math.Round(t*float64(max-1)))
+	return size, incoming
+}
+
+// ThroughColor returns the opacity of the old and new images over a solid
+// colour at progress p: the old image fades into the colour during the first
+// half, the new one out of it during the second.
+func ThroughColor(p float64) (oldA, newA float64) {
+	if p < 0.5 {
+		return 1 - 2*p, 0
+	}
+	return 0, 2*p - 1
+}
+
+func frac(i, n int) float64 {
+	if n <= 1 {
+		return 0
+	}
+	return float64(i) / float64(n-1)
+}
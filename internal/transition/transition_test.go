@@ -0,0 +1,146 @@
+//go:build headless
+// +build headless
+
+package transition
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestAlphaEnds(t *testing.T) {
+	for _, soft := range []float64{0, 0.2, 1} {
+		for _, v := range []float64{0, 0.3, 1} {
+			if a := Alpha(v, 0, soft); a != 0 {
+				t.Errorf("Alpha(%v, 0, %v) = %v, want 0", v, soft, a)
+			}
+			if a := Alpha(v, 1, soft); a != 1 {
+				t.Errorf("Alpha(%v, 1, %v) = %v, want 1", v, soft, a)
+			}
+		}
+	}
+}
+
+func TestAlphaSoftness(t *testing.T) {
+	if a := Alpha(0.2, 0.5, 0); a != 1 {
+		t.Errorf("hard edge behind the front = %v, want 1", a)
+	}
+	if a := Alpha(0.8, 0.5, 0); a != 0 {
+		t.Errorf("hard edge ahead of the front = %v, want 0", a)
+	}
+	// The band runs from v = 0.25, fully shown, to p*(1+s) = 0.75, hidden, so
+	// v = 0.7 is a tenth of the band in from its hidden end.
+	if a := Alpha(0.7, 0.5, 0.5); a < 0.0999 || a > 0.1001 {
+		t.Errorf("soft edge = %v, want 0.1", a)
+	}
+}
+
+func TestMask(t *testing.T) {
+	pix := make([]byte, 8)
+	Mask(pix, []float64{0, 1}, 0.5, 0)
+	want := []byte{255, 255, 255, 255, 0, 0, 0, 0}
+	for i := range want {
+		if pix[i] != want[i] {
+			t.Fatalf("Mask = %v, want %v", pix, want)
+		}
+	}
+}
+
+func TestInverseMaskHidesThroughWipe(t *testing.T) {
+	order := Ramp(4, 1, Right)
+	pix := make([]byte, 16)
+	InverseMask(pix, order, 0.5, 0)
+	for x, want := range []byte{0, 0, 255, 255} {
+		if a := pix[4*x+3]; a != want {
+			t.Fatalf("halfway, pixel %d alpha = %d, want %d", x, a, want)
+		}
+	}
+	InverseMask(pix, order, 1, 0.2)
+	for x := 0; x < 4; x++ {
+		if a := pix[4*x+3]; a != 0 {
+			t.Fatalf("a hidden layer should be gone at the end, pixel %d alpha = %d", x, a)
+		}
+	}
+}
+
+func TestRamp(t *testing.T) {
+	tests := []struct {
+		dir         string
+		first, last float64
+	}{
+		{Right, 0, 1},
+		{Left, 1, 0},
+		{Down, 0, 1},
+		{Up, 1, 0},
+	}
+	for _, tt := range tests {
+		o := Ramp(3, 3, tt.dir)
+		if o[0] != tt.first || o[8] != tt.last {
+			t.Errorf("Ramp(%s) corners = %v, %v; want %v, %v", tt.dir, o[0], o[8], tt.first, tt.last)
+		}
+	}
+	if o := Ramp(3, 1, Right); o[1] != 0.5 {
+		t.Errorf("Ramp middle = %v, want 0.5", o[1])
+	}
+}
+
+func TestIrisOrder(t *testing.T) {
+	o := IrisOrder(4, 4)
+	if !(o[5] < o[0]) {
+		t.Errorf("centre should open before the corner: %v", o)
+	}
+}
+
+func TestFromImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 1))
+	img.SetGray(0, 0, color.Gray{Y: 0})
+	img.SetGray(1, 0, color.Gray{Y: 255})
+	o := FromImage(img, 4, 1)
+	want := []float64{0, 0, 1, 1}
+	for i := range want {
+		if o[i] != want[i] {
+			t.Fatalf("FromImage = %v, want %v", o, want)
+		}
+	}
+}
+
+func TestSlideOffset(t *testing.T) {
+	if dx, dy := SlideOffset(Right, 0, 100, 50); dx != -100 || dy != 0 {
+		t.Errorf("start = %v, %v", dx, dy)
+	}
+	if dx, dy := SlideOffset(Up, 0.5, 100, 50); dx != 0 || dy != 25 {
+		t.Errorf("middle = %v, %v", dx, dy)
+	}
+	if dx, dy := SlideOffset(Left, 1, 100, 50); dx != 0 || dy != 0 {
+		t.Errorf("end = %v, %v", dx, dy)
+	}
+}
+
+func TestPixelBlock(t *testing.T) {
+	tests := []struct {
+		p        float64
+		size     int
+		incoming bool
+	}{
+		{0, 1, false},
+		{0.25, 9, false},
+		{0.5, 17, true},
+		{1, 1, true},
+	}
+	for _, tt := range tests {
+		size, in := PixelBlock(tt.p, 17)
+		if size != tt.size || in != tt.incoming {
+			t.Errorf("PixelBlock(%v) = %d, %v; want %d, %v", tt.p, size, in, tt.size, tt.incoming)
+		}
+	}
+}
+
+func TestThroughColor(t *testing.T) {
+	if o, n := ThroughColor(0.25); o != 0.5 || n != 0 {
+		t.Errorf("first half = %v, %v", o, n)
+	}
+	if o, n := ThroughColor(0.75); o != 0 || n != 0.5 {
+		t.Errorf("second half = %v, %v", o, n)
+	}
+}
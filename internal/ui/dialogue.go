@@ -9,17 +9,84 @@ import (
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/text/v2"
+
+	"novegido/internal/linebreak"
 )
 
+// Speaker describes who is talking: the name to show, its colours and an
+// optional side portrait. Nil colours default to white.
+type Speaker struct {
+	Name      string
+	NameColor color.Color
+	TextColor color.Color
+	Portrait  *ebiten.Image
+}
+
+func colorOr(c, def color.Color) color.Color {
+	if c == nil {
+		return def
+	}
+	return c
+}
+
 // DialogueBox represents the main dialogue area.
 type DialogueBox struct {
 	Rect      image.Rectangle
 	Frame     *NineSlice
 	NameFrame *NineSlice
+	LineBreak linebreak.Options
+}
+
+const (
+	dialoguePadding = 20
+	namePlateHeight = 24
+)
+
+// LineHeight returns the distance between consecutive lines set in face.
+func LineHeight(face text.Face) float64 {
+	m := face.Metrics()
+	return m.HAscent + m.HDescent + m.HLineGap
+}
+
+// Measure returns a linebreak.MeasureFunc using the advance widths of face.
+func Measure(face text.Face) linebreak.MeasureFunc {
+	return func(s string) float64 { return text.Advance(s, face) }
 }
 
-// Draw renders the dialogue box along with speaker name and text.
-func (d DialogueBox) Draw(screen *ebiten.Image, face text.Face, name, txt string) {
+// textTop returns the y coordinate of the first line of text, which is pushed
+// down when a name plate is shown.
+func (d DialogueBox) textTop(hasName bool) int {
+	y := d.Rect.Min.Y + dialoguePadding
+	if hasName {
+		y += namePlateHeight + 10
+	}
+	return y
+}
+
+// portraitWidth returns the horizontal space taken by the speaker's side
+// portrait, which is scaled to the inner height of the box.
+func (d DialogueBox) portraitWidth(sp Speaker) int {
+	if sp.Portrait == nil {
+		return 0
+	}
+	pw, ph := sp.Portrait.Bounds().Dx(), sp.Portrait.Bounds().Dy()
+	h := d.Rect.Dy() - 2*dialoguePadding
+	return pw*h/ph + dialoguePadding
+}
+
+// Layout wraps txt to the inner width of the box and splits the result into
+// pages that each fit inside the box. The returned pages are what Draw
+// expects, one page at a time.
+func (d DialogueBox) Layout(face text.Face, sp Speaker, txt string) [][]Line {
+	width := float64(d.Rect.Dx() - 2*dialoguePadding - d.portraitWidth(sp))
+	lines := Lines(txt, linebreak.Wrap(txt, width, Measure(face), d.LineBreak))
+	avail := float64(d.Rect.Max.Y - dialoguePadding - d.textTop(sp.Name != ""))
+	return Paginate(lines, int(avail/LineHeight(face)))
+}
+
+// Draw renders the dialogue box along with the speaker's portrait and name
+// and one page of lines produced by Layout.
+func (d DialogueBox) Draw(screen *ebiten.Image, face text.Face, sp Speaker, lines []Line) {
 	if d.Frame != nil {
 		d.Frame.Draw(screen, d.Rect)
 	} else {
@@ -30,14 +97,24 @@ func (d DialogueBox) Draw(screen *ebiten.Image, face text.Face, name, txt string
 		screen.DrawImage(box, op)
 	}
 
-	y := float64(d.Rect.Min.Y + 20)
+	left := d.Rect.Min.X + dialoguePadding
+	if sp.Portrait != nil {
+		h := float64(d.Rect.Dy() - 2*dialoguePadding)
+		s := h / float64(sp.Portrait.Bounds().Dy())
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(s, s)
+		op.GeoM.Translate(float64(left), float64(d.Rect.Min.Y+dialoguePadding))
+		op.Filter = ebiten.FilterLinear
+		screen.DrawImage(sp.Portrait, op)
+		left += d.portraitWidth(sp)
+	}
 
-	if name != "" {
-		nameHeight := 24
+	if sp.Name != "" {
+		nameHeight := namePlateHeight
 		nameRect := image.Rect(
-			d.Rect.Min.X+20,
+			left,
 			d.Rect.Min.Y+10,
-			d.Rect.Min.X+20+d.Rect.Dx()/3,
+			left+d.Rect.Dx()/3,
 			d.Rect.Min.Y+10+nameHeight,
 		)
 		if d.NameFrame != nil {
@@ -52,14 +129,17 @@ func (d DialogueBox) Draw(screen *ebiten.Image, face text.Face, name, txt string
 
 		ntOp := &text.DrawOptions{}
 		ntOp.GeoM.Translate(float64(nameRect.Min.X+10), float64(nameRect.Max.Y-6))
-		ntOp.ColorScale.ScaleWithColor(color.White)
-		text.Draw(screen, name, face, ntOp)
-
-		y += float64(nameRect.Dy() + 10)
+		ntOp.ColorScale.ScaleWithColor(colorOr(sp.NameColor, color.White))
+		text.Draw(screen, sp.Name, face, ntOp)
 	}
 
-	tOp := &text.DrawOptions{}
-	tOp.GeoM.Translate(float64(d.Rect.Min.X+20), y)
-	tOp.ColorScale.ScaleWithColor(color.White)
-	text.Draw(screen, txt, face, tOp)
+	y := float64(d.textTop(sp.Name != ""))
+	lh := LineHeight(face)
+	for _, line := range lines {
+		tOp := &text.DrawOptions{}
+		tOp.GeoM.Translate(float64(left), y)
+		tOp.ColorScale.ScaleWithColor(colorOr(sp.TextColor, color.White))
+		text.Draw(screen, line.Text, face, tOp)
+		y += lh
+	}
 }
@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"novegido/internal/linebreak"
+)
+
+// Line is one laid-out line of text, or one column for vertical text,
+// together with the rune offset of its first character in the source text.
+// The offset lets annotations such as ruby be placed on the right glyphs.
+type Line struct {
+	Text   string
+	Offset int
+}
+
+// Lines pairs the output of linebreak.Wrap with rune offsets into src.
+// Spaces dropped at line boundaries are skipped over.
+func Lines(src string, wrapped []string) []Line {
+	lines := make([]Line, 0, len(wrapped))
+	rest := src
+	offset := 0
+	for _, w := range wrapped {
+		for rest != "" && !strings.HasPrefix(rest, w) {
+			_, size := utf8.DecodeRuneInString(rest)
+			rest = rest[size:]
+			offset++
+		}
+		lines = append(lines, Line{Text: w, Offset: offset})
+		if strings.HasPrefix(rest, w) {
+			rest = rest[len(w):]
+			offset += utf8.RuneCountInString(w)
+		}
+	}
+	return lines
+}
+
+// Paginate groups lines into pages of at most perPage lines each.
+func Paginate[T any](lines []T, perPage int) [][]T {
+	if perPage < 1 {
+		perPage = 1
+	}
+	var pages [][]T
+	for len(lines) > perPage {
+		pages = append(pages, lines[:perPage])
+		lines = lines[perPage:]
+	}
+	return append(pages, lines)
+}
+
+// Orientation describes how a glyph is set in vertical text.
+type Orientation int
+
+const (
+	// Upright glyphs are drawn as in horizontal text.
+	Upright Orientation = iota
+	// Sideways glyphs are rotated 90° clockwise: long vowel marks, dashes,
+	// brackets and Latin text.
+	Sideways
+	// Corner glyphs are the ideographic comma and full stop, which move to
+	// the upper right of their cell.
+	Corner
+)
+
+const sidewaysRunes = "ー－―‐—–~〜～…‥=＝「」『』（）［］｛｝〔〕〈〉《》【】〘〙〖〗()[]{}<>"
+
+// VerticalOrientation returns how r is drawn in a vertical column.
+func VerticalOrientation(r rune) Orientation {
+	switch {
+	case r == '、' || r == '。' || r == '，' || r == '．':
+		return Corner
+	case strings.ContainsRune(sidewaysRunes, r):
+		return Sideways
+	case !linebreak.IsWide(r):
+		return Sideways
+	}
+	return Upright
+}
+
+// VerticalMeasure returns the length of text along a vertical column: wide
+// characters occupy one em each and sideways text takes its horizontal
+// advance.
+func VerticalMeasure(em float64, advance linebreak.MeasureFunc) linebreak.MeasureFunc {
+	return func(s string) float64 {
+		var total float64
+		for _, r := range s {
+			total += VerticalAdvance(r, em, advance)
+		}
+		return total
+	}
+}
+
+// VerticalAdvance returns how far r moves the pen down a vertical column.
+func VerticalAdvance(r rune, em float64, advance linebreak.MeasureFunc) float64 {
+	if VerticalOrientation(r) == Sideways && !linebreak.IsWide(r) {
+		return advance(string(r))
+	}
+	return em
+}
@@ -0,0 +1,61 @@
+//go:build headless
+// +build headless
+
+package ui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	lines := []string{"1", "2", "3", "4", "5"}
+	got := Paginate(lines, 2)
+	want := [][]string{{"1", "2"}, {"3", "4"}, {"5"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Paginate = %q, want %q", got, want)
+	}
+	if got := Paginate[string](nil, 3); len(got) != 1 || len(got[0]) != 0 {
+		t.Errorf("Paginate(nil) = %q, want one empty page", got)
+	}
+}
+
+func TestLines(t *testing.T) {
+	got := Lines("ab  cd ef", []string{"ab", "cd", "ef"})
+	want := []Line{{"ab", 0}, {"cd", 4}, {"ef", 7}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines = %+v, want %+v", got, want)
+	}
+	got = Lines("錬金術と石", []string{"錬金", "術と石"})
+	want = []Line{{"錬金", 0}, {"術と石", 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines = %+v, want %+v", got, want)
+	}
+}
+
+func TestVerticalOrientation(t *testing.T) {
+	tests := []struct {
+		r    rune
+		want Orientation
+	}{
+		{'あ', Upright},
+		{'漢', Upright},
+		{'ー', Sideways},
+		{'「', Sideways},
+		{'A', Sideways},
+		{'、', Corner},
+		{'。', Corner},
+	}
+	for _, tt := range tests {
+		if got := VerticalOrientation(tt.r); got != tt.want {
+			t.Errorf("VerticalOrientation(%q) = %v, want %v", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestVerticalMeasure(t *testing.T) {
+	measure := VerticalMeasure(20, func(s string) float64 { return 7 })
+	if got := measure("あーA"); got != 47 {
+		t.Errorf("measure = %v, want 47", got)
+	}
+}
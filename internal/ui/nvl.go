@@ -0,0 +1,78 @@
+//go:build !headless
+// +build !headless
+
+package ui
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+
+	"novegido/internal/linebreak"
+)
+
+// NVLEntry is one line of dialogue on the NVL panel.
+type NVLEntry struct {
+	Speaker Speaker
+	Text    string
+}
+
+// NVLPanel shows many lines of dialogue accumulating on a translucent panel
+// covering the screen. Speaker names are set in a gutter to the left of the
+// text. When the lines no longer fit, the oldest scroll off the top.
+type NVLPanel struct {
+	Rect      image.Rectangle
+	LineBreak linebreak.Options
+}
+
+type nvlRow struct {
+	speaker Speaker
+	name    string
+	text    string
+}
+
+func (p NVLPanel) gutter() int { return p.Rect.Dx() / 5 }
+
+// Draw renders the panel and as many of the most recent entries as fit.
+func (p NVLPanel) Draw(screen *ebiten.Image, face text.Face, entries []NVLEntry) {
+	box := ebiten.NewImage(p.Rect.Dx(), p.Rect.Dy())
+	box.Fill(color.RGBA{0, 0, 0, 160})
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(float64(p.Rect.Min.X), float64(p.Rect.Min.Y))
+	screen.DrawImage(box, op)
+
+	width := float64(p.Rect.Dx() - p.gutter() - 2*dialoguePadding)
+	var rows []nvlRow
+	for _, e := range entries {
+		for i, line := range linebreak.Wrap(e.Text, width, Measure(face), p.LineBreak) {
+			row := nvlRow{speaker: e.Speaker, text: line}
+			if i == 0 {
+				row.name = e.Speaker.Name
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	lh := LineHeight(face)
+	fit := int(float64(p.Rect.Dy()-2*dialoguePadding) / lh)
+	if len(rows) > fit {
+		rows = rows[len(rows)-fit:]
+	}
+
+	y := float64(p.Rect.Min.Y + dialoguePadding)
+	for _, r := range rows {
+		if r.name != "" {
+			nOp := &text.DrawOptions{}
+			nOp.GeoM.Translate(float64(p.Rect.Min.X+dialoguePadding), y)
+			nOp.ColorScale.ScaleWithColor(colorOr(r.speaker.NameColor, color.RGBA{255, 220, 120, 255}))
+			text.Draw(screen, r.name, face, nOp)
+		}
+		tOp := &text.DrawOptions{}
+		tOp.GeoM.Translate(float64(p.Rect.Min.X+dialoguePadding+p.gutter()), y)
+		tOp.ColorScale.ScaleWithColor(colorOr(r.speaker.TextColor, color.White))
+		text.Draw(screen, r.text, face, tOp)
+		y += lh
+	}
+}
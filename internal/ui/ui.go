@@ -11,7 +11,8 @@ import (
 
 // UI holds assets used for rendering user interface elements.
 type UI struct {
-	Face text.Face
+	Face     text.Face
+	RubyFace text.Face
 }
 
 // New loads the default font and returns a UI object.
@@ -26,5 +27,8 @@ func New() (*UI, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &UI{Face: &text.GoTextFace{Source: src, Size: 22}}, nil
+	return &UI{
+		Face:     &text.GoTextFace{Source: src, Size: 22},
+		RubyFace: &text.GoTextFace{Source: src, Size: 11},
+	}, nil
 }
@@ -0,0 +1,137 @@
+//go:build !headless
+// +build !headless
+
+package ui
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+
+	"novegido/internal/linebreak"
+	"novegido/internal/script"
+)
+
+// VerticalBox renders text in vertical columns (tategaki) that run top to
+// bottom and flow from right to left. The speaker's name takes the rightmost
+// column and ruby is set to the right of its base text.
+type VerticalBox struct {
+	Rect      image.Rectangle
+	Frame     *NineSlice
+	LineBreak linebreak.Options
+}
+
+// columnWidth leaves room on the right of each column for ruby.
+func columnWidth(face text.Face) float64 { return LineHeight(face) * 1.5 }
+
+func em(face text.Face) float64 { return text.Advance("国", face) }
+
+// Layout breaks txt into columns that fit the height of the box and splits
+// them into pages that fit its width.
+func (v VerticalBox) Layout(face text.Face, sp Speaker, txt string) [][]Line {
+	height := float64(v.Rect.Dy() - 2*dialoguePadding)
+	measure := VerticalMeasure(em(face), Measure(face))
+	cols := Lines(txt, linebreak.Wrap(txt, height, measure, v.LineBreak))
+	width := float64(v.Rect.Dx() - 2*dialoguePadding)
+	if sp.Name != "" {
+		width -= columnWidth(face)
+	}
+	return Paginate(cols, int(width/columnWidth(face)))
+}
+
+// Draw renders the box, the speaker's name and one page of columns produced
+// by Layout. Ruby annotations index runes of the text passed to Layout.
+func (v VerticalBox) Draw(screen *ebiten.Image, face, rubyFace text.Face, sp Speaker, cols []Line, ruby []script.Ruby) {
+	if v.Frame != nil {
+		v.Frame.Draw(screen, v.Rect)
+	} else {
+		box := ebiten.NewImage(v.Rect.Dx(), v.Rect.Dy())
+		box.Fill(color.RGBA{0, 0, 0, 180})
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(float64(v.Rect.Min.X), float64(v.Rect.Min.Y))
+		screen.DrawImage(box, op)
+	}
+
+	cw := columnWidth(face)
+	x := float64(v.Rect.Max.X-dialoguePadding) - cw
+	top := float64(v.Rect.Min.Y + dialoguePadding)
+	if sp.Name != "" {
+		v.drawColumn(screen, face, sp.Name, x, top, colorOr(sp.NameColor, color.RGBA{255, 220, 120, 255}))
+		x -= cw
+	}
+	for _, col := range cols {
+		ys := v.drawColumn(screen, face, col.Text, x, top, colorOr(sp.TextColor, color.White))
+		v.drawRuby(screen, face, rubyFace, col, ys, x, ruby)
+		x -= cw
+	}
+}
+
+// drawColumn draws s downwards from (x, top) and returns the y coordinate
+// of each glyph followed by the end of the column.
+func (v VerticalBox) drawColumn(screen *ebiten.Image, face text.Face, s string, x, top float64, clr color.Color) []float64 {
+	e := em(face)
+	lh := LineHeight(face)
+	cw := columnWidth(face)
+	adv := Measure(face)
+	var ys []float64
+	y := top
+	for _, r := range s {
+		ys = append(ys, y)
+		g := string(r)
+		op := &text.DrawOptions{}
+		switch VerticalOrientation(r) {
+		case Sideways:
+			// Rotating clockwise about the origin moves the glyph box to
+			// the left of it, so shift right by a line height to centre.
+			op.GeoM.Rotate(math.Pi / 2)
+			op.GeoM.Translate(x+(cw-e)/2+(e+lh)/2, y)
+		case Corner:
+			op.GeoM.Translate(x+(cw-e)/2+e*0.5, y-e*0.5)
+		default:
+			op.GeoM.Translate(x+(cw-e)/2, y)
+		}
+		op.ColorScale.ScaleWithColor(clr)
+		text.Draw(screen, g, face, op)
+		y += VerticalAdvance(r, e, adv)
+	}
+	return append(ys, y)
+}
+
+// drawRuby sets each annotation overlapping col beside its base glyphs,
+// centred on them.
+func (v VerticalBox) drawRuby(screen *ebiten.Image, face, rubyFace text.Face, col Line, ys []float64, x float64, ruby []script.Ruby) {
+	n := len(ys) - 1
+	e := em(face)
+	re := em(rubyFace)
+	cw := columnWidth(face)
+	for _, rb := range ruby {
+		start := rb.Start - col.Offset
+		end := rb.End - col.Offset
+		if end <= 0 || start >= n {
+			continue
+		}
+		if start < 0 {
+			start = 0
+		}
+		if end > n {
+			end = n
+		}
+		var count int
+		for range rb.Text {
+			count++
+		}
+		mid := (ys[start] + ys[end]) / 2
+		y := mid - float64(count)*re/2
+		rx := x + (cw-e)/2 + e
+		for _, r := range rb.Text {
+			op := &text.DrawOptions{}
+			op.GeoM.Translate(rx, y)
+			op.ColorScale.ScaleWithColor(color.White)
+			text.Draw(screen, string(r), rubyFace, op)
+			y += re
+		}
+	}
+}
@@ -6,34 +6,68 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
 
 	"github.com/hajimehoshi/ebiten/v2"
 
+	"novegido/internal/character"
 	"novegido/internal/game"
+	"novegido/internal/project"
 	"novegido/internal/script"
 	"novegido/internal/ui"
 )
 
 var (
-	screenWidth  = flag.Int("width", 640, "screen width")
-	screenHeight = flag.Int("height", 480, "screen height")
+	windowWidth  = flag.Int("width", 0, "initial window width (defaults to the project width)")
+	windowHeight = flag.Int("height", 0, "initial window height (defaults to the project height)")
+	projectPath  = flag.String("project", "assets/project.json", "project settings file")
+	scriptPath   = flag.String("script", "assets/scripts/demo.json", "script file to load")
+	lintOnly     = flag.Bool("lint", false, "check the script for problems and exit")
 )
 
 func main() {
 	flag.Parse()
 
-	pages, err := script.LoadScripts("assets/scripts/demo.json")
+	cfg, err := project.Load(*projectPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	cast, err := character.Load(cfg.Characters, cfg.Language)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pages, err := script.LoadScripts(*scriptPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	warns := script.Lint(pages, script.LintOptions{Positions: cfg.PositionNames()})
+	for _, w := range warns {
+		log.Printf("lint: %s", w)
+	}
+	if *lintOnly {
+		if len(warns) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
 	uiObj, err := ui.New()
 	if err != nil {
 		log.Fatal(err)
 	}
-	g := game.NewGame(uiObj, pages, *screenWidth, *screenHeight)
-	ebiten.SetWindowSize(*screenWidth, *screenHeight)
-	ebiten.SetWindowTitle("Novel Game Demo")
+	g := game.NewGame(uiObj, pages, cfg, cast)
+	g.SetScriptPath(*scriptPath)
+
+	w, h := *windowWidth, *windowHeight
+	if w <= 0 || h <= 0 {
+		w, h = cfg.Width, cfg.Height
+	}
+	ebiten.SetWindowSize(w, h)
+	ebiten.SetWindowTitle(cfg.Title)
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
 	if err := ebiten.RunGame(g); err != nil {
 		log.Fatal(err)
 	}